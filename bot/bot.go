@@ -0,0 +1,273 @@
+// Headless players for load tests
+//
+// A bot logs in through the client package, keeps its connection alive and
+// acts out a script of walking, chatting and digging.
+
+package bot
+
+import (
+	"os"
+	"math"
+	"sync"
+	"time"
+	"client"
+)
+
+const (
+	TickLength = 50e6 // ns between position updates, like a real client
+	WalkSpeed  = 4.3  // blocks per second
+	EyeHeight  = 1.62 // stance above feet
+	idlePeriod = 20   // ticks between keep-alive flying packets when idle
+)
+
+// Counters describing a bot's traffic
+type Stats struct {
+	PacketsReceived int64
+	PacketsSent     int64
+	ChunksReceived  int64
+}
+
+type Bot struct {
+	client.IgnorePackets
+	Client *client.Client
+
+	lock     sync.Mutex
+	x, y, z  float64
+	rotation float32
+	pitch    float32
+	stats    Stats
+	err      os.Error // why the connection ended, nil while connected
+	kickedBy string   // disconnect reason sent by the server
+	done     chan bool
+}
+
+// Log in to a server as a new bot
+func Connect(addr string, username string, version int32) (bot *Bot, err os.Error) {
+	c, err := client.Dial(addr, username, version)
+	if err != nil {
+		return
+	}
+	return New(c), nil
+}
+
+// Start a bot on a client that has already logged in
+func New(c *client.Client) *Bot {
+	bot := &Bot{
+		Client: c,
+		done:   make(chan bool),
+	}
+	go bot.receiveLoop()
+	return bot
+}
+
+func (bot *Bot) receiveLoop() {
+	for {
+		packet, err := bot.Client.ReadPacket()
+		if err == nil {
+			bot.lock.Lock()
+			bot.stats.PacketsReceived++
+			bot.lock.Unlock()
+
+			err = client.DispatchPacket(packet, bot)
+		}
+		if err != nil {
+			bot.lock.Lock()
+			if bot.err == nil {
+				bot.err = err
+			}
+			bot.lock.Unlock()
+			break
+		}
+	}
+	bot.Client.Close()
+	close(bot.done)
+}
+
+// Why the connection ended, or nil if the bot is still connected
+func (bot *Bot) Err() os.Error {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	return bot.err
+}
+
+// The reason given by the server if it kicked the bot
+func (bot *Bot) KickReason() string {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	return bot.kickedBy
+}
+
+// Block until the connection ends
+func (bot *Bot) Wait() os.Error {
+	<-bot.done
+	return bot.Err()
+}
+
+func (bot *Bot) Stats() Stats {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	return bot.stats
+}
+
+func (bot *Bot) Position() (x, y, z float64) {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	return bot.x, bot.y, bot.z
+}
+
+// Send a packet through one of the client's Send* methods
+func (bot *Bot) send(err os.Error) os.Error {
+	if err == nil {
+		bot.lock.Lock()
+		bot.stats.PacketsSent++
+		bot.lock.Unlock()
+	}
+	return err
+}
+
+// Log out and close the connection
+func (bot *Bot) Quit(reason string) {
+	bot.send(bot.Client.SendDisconnect(reason))
+	bot.Client.Close()
+	<-bot.done
+}
+
+func (bot *Bot) PacketKeepAlive() {
+	bot.send(bot.Client.SendKeepAlive())
+}
+
+func (bot *Bot) PacketPlayerPositionLook(x, y, stance, z float64, rotation, pitch float32, flying bool) {
+	bot.lock.Lock()
+	bot.x, bot.y, bot.z = x, y, z
+	bot.rotation, bot.pitch = rotation, pitch
+	bot.lock.Unlock()
+
+	// Clients confirm positions set by the server by echoing them
+	bot.send(bot.Client.SendPositionLook(x, y, stance, z, rotation, pitch, flying))
+}
+
+func (bot *Bot) PacketMapChunk(x int32, y int16, z int32, sizeX, sizeY, sizeZ byte, data []byte) {
+	bot.lock.Lock()
+	bot.stats.ChunksReceived++
+	bot.lock.Unlock()
+}
+
+func (bot *Bot) PacketDisconnect(reason string) {
+	bot.lock.Lock()
+	bot.kickedBy = reason
+	if bot.err == nil {
+		bot.err = &client.KickedError{reason}
+	}
+	bot.lock.Unlock()
+}
+
+// A step of a bot's script
+type Action func(bot *Bot) os.Error
+
+// Run actions in order until one fails or the connection ends
+func (bot *Bot) RunScript(script []Action) (err os.Error) {
+	for _, action := range script {
+		err = bot.Err()
+		if err != nil {
+			return
+		}
+
+		err = action(bot)
+		if err != nil {
+			return
+		}
+	}
+	return bot.Err()
+}
+
+// Walk in a straight line at walking speed
+func WalkTo(x, y, z float64) Action {
+	return func(bot *Bot) (err os.Error) {
+		step := WalkSpeed * TickLength / 1e9
+		for {
+			bot.lock.Lock()
+			dx, dy, dz := x-bot.x, y-bot.y, z-bot.z
+			distance := math.Sqrt(dx*dx + dy*dy + dz*dz)
+			if distance <= step {
+				bot.x, bot.y, bot.z = x, y, z
+			} else {
+				bot.x += dx * step / distance
+				bot.y += dy * step / distance
+				bot.z += dz * step / distance
+			}
+			px, py, pz := bot.x, bot.y, bot.z
+			bot.lock.Unlock()
+
+			err = bot.send(bot.Client.SendPosition(px, py, py+EyeHeight, pz, true))
+			if err != nil || distance <= step {
+				return
+			}
+
+			time.Sleep(TickLength)
+			err = bot.Err()
+			if err != nil {
+				return
+			}
+		}
+		panic("unreachable")
+	}
+}
+
+// Walk relative to the current position
+func WalkBy(dx, dy, dz float64) Action {
+	return func(bot *Bot) os.Error {
+		x, y, z := bot.Position()
+		return WalkTo(x+dx, y+dy, z+dz)(bot)
+	}
+}
+
+func Say(message string) Action {
+	return func(bot *Bot) os.Error {
+		return bot.send(bot.Client.SendChatMessage(message))
+	}
+}
+
+// Dig out a block, taking digTime nanoseconds
+func Dig(x int32, y byte, z int32, digTime int64) Action {
+	return func(bot *Bot) (err os.Error) {
+		const faceTop = 1
+
+		err = bot.send(bot.Client.SendDigging(client.DigStarted, x, y, z, faceTop))
+		if err != nil {
+			return
+		}
+		time.Sleep(digTime)
+		return bot.send(bot.Client.SendDigging(client.DigBroken, x, y, z, faceTop))
+	}
+}
+
+// Dig out the block the bot is standing on
+func DigBelow(digTime int64) Action {
+	return func(bot *Bot) os.Error {
+		x, y, z := bot.Position()
+		return Dig(int32(math.Floor(x)), byte(y-1), int32(math.Floor(z)), digTime)(bot)
+	}
+}
+
+// Stand still for a number of nanoseconds, sending the idle packets a real
+// client sends so that the server does not time the bot out
+func Idle(duration int64) Action {
+	return func(bot *Bot) (err os.Error) {
+		end := time.Nanoseconds() + duration
+		for tick := 0; time.Nanoseconds() < end; tick++ {
+			if tick%idlePeriod == 0 {
+				err = bot.send(bot.Client.SendFlying(true))
+				if err != nil {
+					return
+				}
+			}
+
+			time.Sleep(TickLength)
+			err = bot.Err()
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+}
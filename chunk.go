@@ -3,11 +3,12 @@
 package main
 
 import (
-	"bytes"
 	"io"
 	"os"
+	"bytes"
 	"log"
-	"path"
+	"math"
+	"sort"
 	"nbt"
 )
 
@@ -21,6 +22,22 @@ const (
 	ChunkRadius = 10
 )
 
+// Block types
+const (
+	BlockAir             = 0
+	BlockStone           = 1
+	BlockGrass           = 2
+	BlockDirt            = 3
+	BlockCobblestone     = 4
+	BlockBedrock         = 7
+	BlockWater           = 8
+	BlockStationaryWater = 9
+	BlockLava            = 10
+	BlockStationaryLava  = 11
+	BlockChest           = 54
+	BlockSignPost        = 63
+)
+
 type ChunkCoord int32
 
 // A chunk is slice of the world map
@@ -31,12 +48,127 @@ type Chunk struct {
 	SkyLight   []byte
 	BlockLight []byte
 	HeightMap  []byte
-	players    map[EntityID]*Player
+
+	// Players whose radius includes the chunk, who see what happens in it
+	players map[EntityID]*Player
+
+	// Entities inside the chunk
+	entities map[EntityID]EntityObject
+
+	// Tile entities by the index of their block
+	tileEntities map[int]TileEntity
+
+	// Entities loaded with the chunk that are not in the game yet, and
+	// entities of kinds we do not know, which are only kept to be saved
+	pendingEntities []SavedEntity
+	unknownEntities []*nbt.Compound
+
+	// The chunk as loaded, so that tags we do not model are kept when it is
+	// saved.  Nil for chunks that were never saved.
+	data *nbt.NamedTag
+
+	// Whether the chunk changed since it was last saved.  Chunks holding
+	// entities are saved anyway, since the entities may have moved.
+	dirty bool
+
+	// Set for the empty chunks that stand in for chunks that failed to load.
+	// These are never saved, so that whatever the store holds is kept.
+	placeholder bool
 }
 
 // Convert an (x, z) block coordinate pair to chunk coordinates
+// Coordinates are rounded down, so that blocks at negative coordinates end up
+// in the right chunk.
 func BlockToChunkCoords(blockX float64, blockZ float64) (chunkX ChunkCoord, chunkZ ChunkCoord) {
-	return ChunkCoord(blockX / ChunkSizeX), ChunkCoord(blockZ / ChunkSizeZ)
+	return ChunkCoord(math.Floor(blockX / ChunkSizeX)), ChunkCoord(math.Floor(blockZ / ChunkSizeZ))
+}
+
+// Create a chunk of air in full daylight
+func NewChunk(x ChunkCoord, z ChunkCoord) *Chunk {
+	blocks := ChunkSizeX * ChunkSizeY * ChunkSizeZ
+	chunk := &Chunk{
+		X:          x,
+		Z:          z,
+		Blocks:     make([]byte, blocks),
+		BlockData:  make([]byte, blocks/2),
+		SkyLight:   make([]byte, blocks/2),
+		BlockLight: make([]byte, blocks/2),
+		HeightMap:  make([]byte, ChunkSizeX*ChunkSizeZ),
+
+		players:      make(map[EntityID]*Player),
+		entities:     make(map[EntityID]EntityObject),
+		tileEntities: make(map[int]TileEntity),
+	}
+	for i := range chunk.SkyLight {
+		chunk.SkyLight[i] = 0xff
+	}
+	return chunk
+}
+
+// Index into the block arrays of the block at coordinates within a chunk
+func blockIndex(x int, y int, z int) int {
+	return y + z*ChunkSizeY + x*ChunkSizeY*ChunkSizeZ
+}
+
+// The type of the block at coordinates within the chunk
+func (chunk *Chunk) Block(x int, y int, z int) byte {
+	return chunk.Blocks[blockIndex(x, y, z)]
+}
+
+// Change the block at coordinates within the chunk
+// The block's metadata is cleared.  The height map is kept up to date but
+// light is not recalculated.
+func (chunk *Chunk) SetBlock(x int, y int, z int, blockType byte) {
+	index := blockIndex(x, y, z)
+	chunk.Blocks[index] = blockType
+
+	// Metadata is packed two blocks to a byte, the even index in the low
+	// nibble
+	if index&1 == 0 {
+		chunk.BlockData[index>>1] &= 0xf0
+	} else {
+		chunk.BlockData[index>>1] &= 0x0f
+	}
+
+	// The height map holds the height above the topmost solid block
+	column := z*ChunkSizeX + x
+	height := int(chunk.HeightMap[column])
+	switch {
+	case blockType != BlockAir && y >= height:
+		height = y + 1
+	case blockType == BlockAir && y == height-1:
+		for height > 0 && chunk.Block(x, height-1, z) == BlockAir {
+			height--
+		}
+	}
+	chunk.HeightMap[column] = byte(height)
+}
+
+// The tile entities in order of position, so that they are always sent in
+// the same order
+func (chunk *Chunk) TileEntities() []TileEntity {
+	indices := make([]int, 0, len(chunk.tileEntities))
+	for index := range chunk.tileEntities {
+		indices = indices[0 : len(indices)+1]
+		indices[len(indices)-1] = index
+	}
+	sort.SortInts(indices)
+
+	tileEntities := make([]TileEntity, len(indices))
+	for i, index := range indices {
+		tileEntities[i] = chunk.tileEntities[index]
+	}
+	return tileEntities
+}
+
+// Put a tile entity at its block, replacing any tile entity already there
+// Tile entities above or below the world are dropped.
+func (chunk *Chunk) SetTileEntity(tileEntity TileEntity) {
+	x, y, z := tileEntity.Position()
+	if y < 0 || y >= ChunkSizeY {
+		return
+	}
+	chunk.tileEntities[blockIndex(int(x&(ChunkSizeX-1)), y, int(z&(ChunkSizeZ-1)))] = tileEntity
 }
 
 // Load a chunk from its NBT representation
@@ -54,75 +186,236 @@ func loadChunk(reader io.Reader) (chunk *Chunk, err os.Error) {
 		SkyLight:   level.Lookup("/Level/SkyLight").(*nbt.ByteArray).Value,
 		BlockLight: level.Lookup("/Level/BlockLight").(*nbt.ByteArray).Value,
 		HeightMap:  level.Lookup("/Level/HeightMap").(*nbt.ByteArray).Value,
-		players:    make(map[EntityID]*Player),
+
+		players:      make(map[EntityID]*Player),
+		entities:     make(map[EntityID]EntityObject),
+		tileEntities: make(map[int]TileEntity),
+		data:         level,
+	}
+
+	for _, data := range lookupCompounds(level, "/Level/TileEntities") {
+		chunk.SetTileEntity(loadTileEntity(data))
+	}
+
+	entities := lookupCompounds(level, "/Level/Entities")
+	chunk.pendingEntities = make([]SavedEntity, 0, len(entities))
+	chunk.unknownEntities = make([]*nbt.Compound, 0, len(entities))
+	for _, data := range entities {
+		object := loadEntity(data)
+		if object == nil {
+			chunk.unknownEntities = chunk.unknownEntities[0 : len(chunk.unknownEntities)+1]
+			chunk.unknownEntities[len(chunk.unknownEntities)-1] = data
+			continue
+		}
+		chunk.pendingEntities = chunk.pendingEntities[0 : len(chunk.pendingEntities)+1]
+		chunk.pendingEntities[len(chunk.pendingEntities)-1] = object
 	}
 	return
 }
 
-// ChunkManager contains all chunks and can look them up
-type ChunkManager struct {
-	worldPath string
-	chunks    map[uint64]*Chunk
+// Whether the chunk holds entities that are saved with it
+func (chunk *Chunk) hasSavedEntities() bool {
+	if len(chunk.pendingEntities) > 0 {
+		return true
+	}
+	for _, object := range chunk.entities {
+		if _, ok := object.(SavedEntity); ok {
+			return true
+		}
+	}
+	return false
 }
 
-func NewChunkManager(worldPath string) *ChunkManager {
-	return &ChunkManager{
-		worldPath: worldPath,
-		chunks:    make(map[uint64]*Chunk),
+// Write a chunk as NBT, in the format loadChunk reads
+func saveChunk(writer io.Writer, chunk *Chunk) os.Error {
+	if chunk.data == nil {
+		root := nbt.NewCompound()
+		level := nbt.NewCompound()
+		level.Set("TerrainPopulated", &nbt.Byte{1})
+		root.Set("Level", level)
+		chunk.data = nbt.NewNamedTag("", root)
 	}
-}
 
-func base36Encode(n int32) (s string) {
-	alphabet := "0123456789abcdefghijklmnopqrstuvwxyz"
-	negative := false
+	level, ok := chunk.data.Lookup("/Level").(*nbt.Compound)
+	if !ok {
+		return os.NewError("chunk has no Level compound")
+	}
+	level.Set("xPos", &nbt.Int{int32(chunk.X)})
+	level.Set("zPos", &nbt.Int{int32(chunk.Z)})
+	level.Set("Blocks", &nbt.ByteArray{chunk.Blocks})
+	level.Set("Data", &nbt.ByteArray{chunk.BlockData})
+	level.Set("SkyLight", &nbt.ByteArray{chunk.SkyLight})
+	level.Set("BlockLight", &nbt.ByteArray{chunk.BlockLight})
+	level.Set("HeightMap", &nbt.ByteArray{chunk.HeightMap})
 
-	if n < 0 {
-		n = -n
-		negative = true
+	objects := sortedEntities(chunk.entities)
+	entities := make([]*nbt.Compound, 0, len(chunk.unknownEntities)+len(chunk.pendingEntities)+len(objects))
+	add := func(data *nbt.Compound) {
+		entities = entities[0 : len(entities)+1]
+		entities[len(entities)-1] = data
 	}
-	if n == 0 {
-		return "0"
+	for _, data := range chunk.unknownEntities {
+		add(data)
 	}
+	for _, object := range chunk.pendingEntities {
+		add(object.SaveNBT())
+	}
+	for _, object := range objects {
+		if saved, ok := object.(SavedEntity); ok {
+			add(saved.SaveNBT())
+		}
+	}
+	level.Set("Entities", newCompoundList(entities))
 
-	for n != 0 {
-		i := n % int32(len(alphabet))
-		n /= int32(len(alphabet))
-		s = string(alphabet[i:i+1]) + s
+	tileEntities := chunk.TileEntities()
+	compounds := make([]*nbt.Compound, len(tileEntities))
+	for i, tileEntity := range tileEntities {
+		compounds[i] = tileEntity.SaveNBT()
 	}
-	if negative {
-		s = "-" + s
+	level.Set("TileEntities", newCompoundList(compounds))
+
+	return nbt.Write(writer, chunk.data)
+}
+
+// ChunkManager contains all chunks and can look them up
+type ChunkManager struct {
+	store  ChunkStore
+	chunks map[uint64]*Chunk
+
+	// Chunks loaded with entities that are not in the game yet, in the order
+	// they were loaded
+	pendingChunks []*Chunk
+}
+
+func NewChunkManager(store ChunkStore) *ChunkManager {
+	return &ChunkManager{
+		store:  store,
+		chunks: make(map[uint64]*Chunk),
 	}
-	return
 }
 
-func (mgr *ChunkManager) chunkPath(x ChunkCoord, z ChunkCoord) string {
-	return path.Join(mgr.worldPath, base36Encode(int32(x&63)), base36Encode(int32(z&63)),
-		"c."+base36Encode(int32(x))+"."+base36Encode(int32(z))+".dat")
+func chunkKey(x ChunkCoord, z ChunkCoord) uint64 {
+	return uint64(x)<<32 | uint64(uint32(z))
 }
 
-// Get a chunk at given coordinates
+// Get a chunk at given coordinates, loading it if needed
+// A chunk that cannot be loaded, for example because it was never generated,
+// is replaced by an empty one.
 func (mgr *ChunkManager) Get(x ChunkCoord, z ChunkCoord) (chunk *Chunk) {
-	key := uint64(x)<<32 | uint64(uint32(z))
+	key := chunkKey(x, z)
 	chunk, ok := mgr.chunks[key]
 	if ok {
 		return
 	}
 
-	file, err := os.Open(mgr.chunkPath(x, z), os.O_RDONLY, 0)
+	chunk, err := mgr.store.LoadChunk(x, z)
 	if err != nil {
-		log.Exit("ChunkManager.Get: ", err.String())
+		log.Stderrf("ChunkManager.Get: chunk (%d, %d): %s", x, z, err.String())
+		chunk = NewChunk(x, z)
+		chunk.placeholder = true
 	}
 
-	chunk, err = loadChunk(file)
-	file.Close()
-	if err != nil {
-		log.Exit("ChunkManager.loadChunk: ", err.String())
+	mgr.chunks[key] = chunk
+	if len(chunk.pendingEntities) > 0 {
+		n := len(mgr.pendingChunks)
+		if n == cap(mgr.pendingChunks) {
+			grown := make([]*Chunk, n, 2*n+1)
+			copy(grown, mgr.pendingChunks)
+			mgr.pendingChunks = grown
+		}
+		mgr.pendingChunks = mgr.pendingChunks[0 : n+1]
+		mgr.pendingChunks[n] = chunk
 	}
+	return
+}
 
-	mgr.chunks[key] = chunk
+// Take the entities of the chunks loaded since the last call
+// Chunks are loaded wherever they are first needed, even in the middle of
+// adding an entity, so their entities wait in the chunk until the main loop
+// comes to put them into the game.
+func (mgr *ChunkManager) TakePendingEntities() (entities []SavedEntity) {
+	count := 0
+	for _, chunk := range mgr.pendingChunks {
+		count += len(chunk.pendingEntities)
+	}
+
+	entities = make([]SavedEntity, count)
+	n := 0
+	for _, chunk := range mgr.pendingChunks {
+		n += copy(entities[n:], chunk.pendingEntities)
+		chunk.pendingEntities = nil
+	}
+	mgr.pendingChunks = nil
 	return
 }
 
+// Get a chunk at given coordinates if it is loaded
+// Unlike Get, this never loads a chunk.  Whatever goes on at the edge of the
+// loaded area, like items sliding around, uses it so as not to grow the area.
+func (mgr *ChunkManager) Loaded(x ChunkCoord, z ChunkCoord) (chunk *Chunk, ok bool) {
+	chunk, ok = mgr.chunks[chunkKey(x, z)]
+	return
+}
+
+// Write the chunks that changed back to the store
+func (mgr *ChunkManager) SaveChunks() {
+	for _, chunk := range mgr.chunks {
+		if chunk.placeholder || !chunk.dirty && !chunk.hasSavedEntities() {
+			continue
+		}
+
+		err := mgr.store.SaveChunk(chunk)
+		if err != nil {
+			log.Stderrf("SaveChunks: chunk (%d, %d): %s", chunk.X, chunk.Z, err.String())
+			continue
+		}
+		chunk.dirty = false
+	}
+}
+
+// The type of the block at world block coordinates
+// Blocks above and below the world are air.
+func (mgr *ChunkManager) Block(x int32, y int, z int32) byte {
+	if y < 0 || y >= ChunkSizeY {
+		return BlockAir
+	}
+
+	// Shifting rounds towards negative infinity, unlike division
+	chunk := mgr.Get(ChunkCoord(x>>4), ChunkCoord(z>>4))
+	return chunk.Block(int(x&(ChunkSizeX-1)), y, int(z&(ChunkSizeZ-1)))
+}
+
+// The type of the block at world block coordinates, if its chunk is loaded
+func (mgr *ChunkManager) LoadedBlock(x int32, y int, z int32) (blockType byte, ok bool) {
+	if y < 0 || y >= ChunkSizeY {
+		return BlockAir, true
+	}
+
+	chunk, ok := mgr.Loaded(ChunkCoord(x>>4), ChunkCoord(z>>4))
+	if !ok {
+		return
+	}
+	return chunk.Block(int(x&(ChunkSizeX-1)), y, int(z&(ChunkSizeZ-1))), true
+}
+
+// Change the block at world block coordinates and show the change to the
+// players who can see it
+func (mgr *ChunkManager) SetBlock(x int32, y int, z int32, blockType byte) {
+	chunk := mgr.Get(ChunkCoord(x>>4), ChunkCoord(z>>4))
+	bx, bz := int(x&(ChunkSizeX-1)), int(z&(ChunkSizeZ-1))
+	chunk.SetBlock(bx, y, bz, blockType)
+	chunk.dirty = true
+
+	// Whatever the old block held goes with it
+	chunk.tileEntities[blockIndex(bx, y, bz)] = nil, false
+
+	buf := &bytes.Buffer{}
+	WriteBlockChange(buf, x, byte(y), z, blockType, 0)
+	for _, player := range chunk.players {
+		player.TransmitPacket(buf.Bytes())
+	}
+}
+
 // Return a channel to iterate over all chunks within a chunk's radius
 func (mgr *ChunkManager) ChunksInRadius(chunkX ChunkCoord, chunkZ ChunkCoord) (c chan *Chunk) {
 	c = make(chan *Chunk)
@@ -178,42 +471,49 @@ func (mgr *ChunkManager) MulticastPacket(packet []byte, sender *Player) {
 	}
 }
 
-// Add a player to the game
-// This function sends spawn messages to all players in range.  It also spawns
-// all existing players so the new player can see them.
-func (mgr *ChunkManager) AddPlayer(player *Player) {
-	// Add player to chunks within radius
-	for chunk := range mgr.ChunksInPlayerRadius(player) {
-		chunk.players[player.EntityID] = player
+// Add an entity to the chunk it is in
+// Players are also added to the chunks within their radius, so that they see
+// the entities in those chunks.
+func (mgr *ChunkManager) AddEntity(object EntityObject) {
+	entity := object.GetEntity()
+	entity.chunkX, entity.chunkZ = BlockToChunkCoords(entity.position.x, entity.position.z)
+	chunk := mgr.Get(entity.chunkX, entity.chunkZ)
+	chunk.entities[entity.EntityID] = object
+	if _, ok := object.(SavedEntity); ok {
+		chunk.dirty = true
 	}
 
-	// Spawn new player for existing players
-	buf := &bytes.Buffer{}
-	WriteNamedEntitySpawn(buf, player.EntityID, player.name, &player.position, &player.orientation, player.currentItem)
-	mgr.MulticastPacket(buf.Bytes(), player)
-
-	// Spawn existing players for new player
-	buf = &bytes.Buffer{}
-	for existing := range mgr.PlayersInPlayerRadius(player) {
-		if existing == player {
-			continue
+	if player, ok := object.(*Player); ok {
+		for chunk := range mgr.ChunksInRadius(entity.chunkX, entity.chunkZ) {
+			chunk.players[entity.EntityID] = player
 		}
-
-		WriteNamedEntitySpawn(buf, existing.EntityID, existing.name, &existing.position, &existing.orientation, existing.currentItem)
 	}
-	player.TransmitPacket(buf.Bytes())
 }
 
-// Remove a player from the game
-// This function sends destroy messages so the other players see the player
-// disappear.
-func (mgr *ChunkManager) RemovePlayer(player *Player) {
-	// Destroy player for other players
-	buf := &bytes.Buffer{}
-	WriteDestroyEntity(buf, player.EntityID)
-	mgr.MulticastPacket(buf.Bytes(), player)
+// Remove an entity from the chunk it is in
+func (mgr *ChunkManager) RemoveEntity(object EntityObject) {
+	entity := object.GetEntity()
+	chunk := mgr.Get(entity.chunkX, entity.chunkZ)
+	chunk.entities[entity.EntityID] = nil, false
+	if _, ok := object.(SavedEntity); ok {
+		chunk.dirty = true
+	}
 
-	for chunk := range mgr.ChunksInPlayerRadius(player) {
-		chunk.players[player.EntityID] = nil, false
+	if _, ok := object.(*Player); ok {
+		for chunk := range mgr.ChunksInRadius(entity.chunkX, entity.chunkZ) {
+			chunk.players[entity.EntityID] = nil, false
+		}
 	}
 }
+
+// Move an entity to another chunk if it has crossed into one
+func (mgr *ChunkManager) UpdateEntity(object EntityObject) {
+	entity := object.GetEntity()
+	x, z := BlockToChunkCoords(entity.position.x, entity.position.z)
+	if x == entity.chunkX && z == entity.chunkZ {
+		return
+	}
+
+	mgr.RemoveEntity(object)
+	mgr.AddEntity(object)
+}
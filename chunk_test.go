@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"bytes"
+	"testing"
+)
+
+// A furnished chunk comes back from the store with the same blocks, tile
+// entities and entities it was saved with
+func TestSaveFurnishedChunk(t *testing.T) {
+	store := NewMemoryChunkStore(nil)
+	chunk := NewFurnishedChunk(-1, 2, 64, BlockStone)
+	err := store.SaveChunk(chunk)
+	if err != nil {
+		t.Fatal(err.String())
+	}
+
+	loaded, err := store.LoadChunk(-1, 2)
+	if err != nil {
+		t.Fatal(err.String())
+	}
+	if loaded == chunk {
+		t.Fatal("the store kept the chunk instead of saving it")
+	}
+	if loaded.X != -1 || loaded.Z != 2 {
+		t.Errorf("loaded chunk (%d, %d)", loaded.X, loaded.Z)
+	}
+	if !bytes.Equal(loaded.Blocks, chunk.Blocks) || !bytes.Equal(loaded.BlockData, chunk.BlockData) ||
+		!bytes.Equal(loaded.HeightMap, chunk.HeightMap) {
+		t.Error("blocks changed")
+	}
+
+	tileEntities := loaded.TileEntities()
+	if len(tileEntities) != 2 {
+		t.Fatalf("%d tile entities", len(tileEntities))
+	}
+	chest, ok := tileEntities[0].(*Chest)
+	if !ok {
+		t.Fatalf("%#v instead of the chest", tileEntities[0])
+	}
+	if x, y, z := chest.Position(); x != -8 || y != 64 || z != 34 {
+		t.Errorf("chest at (%d, %d, %d)", x, y, z)
+	}
+	if len(chest.items) != 2 || chest.items[1].slot != 13 || chest.items[1].item.ID != BlockDirt ||
+		chest.items[1].item.Count != 64 {
+		t.Errorf("chest holds %v", chest.items)
+	}
+	sign, ok := tileEntities[1].(*Sign)
+	if !ok {
+		t.Fatalf("%#v instead of the sign", tileEntities[1])
+	}
+	if sign.text[0] != "Welcome" || sign.text[3] != "chunk" {
+		t.Errorf("sign reads %v", sign.text)
+	}
+
+	if len(loaded.pendingEntities) != 3 {
+		t.Fatalf("%d entities", len(loaded.pendingEntities))
+	}
+	mob, ok := loaded.pendingEntities[0].(*Mob)
+	if !ok || mob.mobType != MobPig || mob.position.x != -11.5 || mob.position.z != 40.5 {
+		t.Errorf("%#v instead of the pig", loaded.pendingEntities[0])
+	}
+	item, ok := loaded.pendingEntities[1].(*ItemEntity)
+	if !ok || item.itemID != BlockDirt || item.count != 3 {
+		t.Errorf("%#v instead of the item", loaded.pendingEntities[1])
+	}
+	cart, ok := loaded.pendingEntities[2].(*ObjectEntity)
+	if !ok || cart.objectType != ObjectStorageCart {
+		t.Errorf("%#v instead of the storage cart", loaded.pendingEntities[2])
+	}
+}
+
+// Entities of a loaded chunk join the game on the next tick, not while the
+// chunk is being loaded
+func TestLoadedEntitiesJoinOnTick(t *testing.T) {
+	store := NewMemoryChunkStore(nil)
+	store.Put(NewFurnishedChunk(0, 0, 64, BlockStone))
+	mgr := NewChunkManager(store)
+	game := NewGame(mgr, NewLevel("test", 8, 64, 8, 0), NewVirtualClock())
+
+	counts := make(chan int, 2)
+	game.Enqueue(func(game *Game) {
+		mgr.Get(0, 0)
+		counts <- len(game.entityManager.Entities())
+		game.tickEntities()
+		counts <- len(game.entityManager.Entities())
+	})
+	if n := <-counts; n != 0 {
+		t.Errorf("%d entities joined while the chunk was loaded", n)
+	}
+	if n := <-counts; n != 3 {
+		t.Errorf("%d entities joined on the tick, expected 3", n)
+	}
+}
+
+// A player without a connection, whose packets pile up in txPending
+func newTestPlayer(entityID EntityID, x float64, z float64) *Player {
+	player := &Player{
+		game:      &Game{clock: NewVirtualClock()},
+		txPending: &bytes.Buffer{},
+		txWake:    make(chan bool, 1),
+	}
+	player.EntityID = entityID
+	player.position = XYZ{x, 64, z}
+	return player
+}
+
+// Players are in every chunk within their radius and no others
+func TestPlayerRadius(t *testing.T) {
+	mgr := NewChunkManager(NewSingleChunkWorld(NewFlatChunk(0, 0, 64, BlockStone)))
+	player := newTestPlayer(1, 8.5, 8.5)
+	mgr.AddEntity(player)
+
+	for _, c := range [][2]ChunkCoord{{0, 0}, {ChunkRadius, ChunkRadius}, {-ChunkRadius, 0}} {
+		if _, ok := mgr.Get(c[0], c[1]).players[player.EntityID]; !ok {
+			t.Errorf("player missing from chunk (%d, %d)", c[0], c[1])
+		}
+	}
+	for _, c := range [][2]ChunkCoord{{ChunkRadius + 1, 0}, {0, -ChunkRadius - 1}} {
+		if _, ok := mgr.Get(c[0], c[1]).players[player.EntityID]; ok {
+			t.Errorf("player in chunk (%d, %d) outside its radius", c[0], c[1])
+		}
+	}
+
+	// Moving to another chunk moves the radius along
+	player.position.x += ChunkSizeX
+	mgr.UpdateEntity(player)
+	if _, ok := mgr.Get(-ChunkRadius, 0).players[player.EntityID]; ok {
+		t.Error("player still in the chunk that left its radius")
+	}
+	if _, ok := mgr.Get(ChunkRadius+1, 0).players[player.EntityID]; !ok {
+		t.Error("player missing from the chunk that entered its radius")
+	}
+
+	mgr.RemoveEntity(player)
+	if _, ok := mgr.Get(1, 0).players[player.EntityID]; ok {
+		t.Error("removed player still in its chunk")
+	}
+}
+
+// Multicast packets go to the players whose radius overlaps the sender's, but
+// not to the sender
+func TestMulticastPacket(t *testing.T) {
+	mgr := NewChunkManager(NewSingleChunkWorld(NewFlatChunk(0, 0, 64, BlockStone)))
+	sender := newTestPlayer(1, 8.5, 8.5)
+	near := newTestPlayer(2, 8.5+2*ChunkRadius*ChunkSizeX, 8.5)
+	far := newTestPlayer(3, 8.5+(2*ChunkRadius+1)*ChunkSizeX, 8.5)
+	mgr.AddEntity(sender)
+	mgr.AddEntity(near)
+	mgr.AddEntity(far)
+
+	mgr.MulticastPacket([]byte{0x00}, sender)
+	if sender.txPending.Len() != 0 {
+		t.Error("the sender received its own packet")
+	}
+	if near.txPending.Len() != 1 {
+		t.Error("a player whose radius overlaps did not receive the packet")
+	}
+	if far.txPending.Len() != 0 {
+		t.Error("a player too far away received the packet")
+	}
+}
+
+// A store that fails to load anything and counts the chunks saved to it
+type brokenChunkStore struct {
+	saved int
+}
+
+func (store *brokenChunkStore) LoadChunk(x ChunkCoord, z ChunkCoord) (*Chunk, os.Error) {
+	return nil, os.NewError("broken store")
+}
+
+func (store *brokenChunkStore) SaveChunk(chunk *Chunk) os.Error {
+	store.saved++
+	return nil
+}
+
+// Chunks that fail to load are replaced by empty chunks, which are never
+// saved over the originals
+func TestChunkLoadFailure(t *testing.T) {
+	store := &brokenChunkStore{}
+	mgr := NewChunkManager(store)
+
+	chunk := mgr.Get(3, -2)
+	if chunk.X != 3 || chunk.Z != -2 || chunk.Block(0, 0, 0) != BlockAir {
+		t.Errorf("got chunk (%d, %d) with block %d instead of an empty chunk",
+			chunk.X, chunk.Z, chunk.Block(0, 0, 0))
+	}
+
+	mgr.SetBlock(3*ChunkSizeX, 64, -2*ChunkSizeZ, BlockStone)
+	mgr.SaveChunks()
+	if store.saved != 0 {
+		t.Errorf("saved %d chunks that failed to load", store.saved)
+	}
+}
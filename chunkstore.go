@@ -0,0 +1,145 @@
+// Where chunks are loaded from and saved to
+
+package main
+
+import (
+	"os"
+	"path"
+	"bytes"
+)
+
+// A source of chunks for a ChunkManager
+type ChunkStore interface {
+	// Load the chunk at the given chunk coordinates
+	LoadChunk(x ChunkCoord, z ChunkCoord) (*Chunk, os.Error)
+
+	// Store a chunk so that later loads return it as it is now
+	SaveChunk(chunk *Chunk) os.Error
+}
+
+// Chunks stored as NBT files in a world directory, as written by the Alpha
+// client
+type DirChunkStore struct {
+	worldPath string
+}
+
+func NewDirChunkStore(worldPath string) *DirChunkStore {
+	return &DirChunkStore{worldPath: worldPath}
+}
+
+func base36Encode(n int32) (s string) {
+	alphabet := "0123456789abcdefghijklmnopqrstuvwxyz"
+	negative := false
+
+	if n < 0 {
+		n = -n
+		negative = true
+	}
+	if n == 0 {
+		return "0"
+	}
+
+	for n != 0 {
+		i := n % int32(len(alphabet))
+		n /= int32(len(alphabet))
+		s = string(alphabet[i:i+1]) + s
+	}
+	if negative {
+		s = "-" + s
+	}
+	return
+}
+
+func (store *DirChunkStore) chunkPath(x ChunkCoord, z ChunkCoord) string {
+	return path.Join(store.worldPath, base36Encode(int32(x&63)), base36Encode(int32(z&63)),
+		"c."+base36Encode(int32(x))+"."+base36Encode(int32(z))+".dat")
+}
+
+func (store *DirChunkStore) LoadChunk(x ChunkCoord, z ChunkCoord) (chunk *Chunk, err os.Error) {
+	file, err := os.Open(store.chunkPath(x, z), os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+
+	chunk, err = loadChunk(file)
+	file.Close()
+	return
+}
+
+// The file is replaced atomically so a crash while saving cannot corrupt the
+// chunk
+func (store *DirChunkStore) SaveChunk(chunk *Chunk) (err os.Error) {
+	chunkPath := store.chunkPath(chunk.X, chunk.Z)
+	err = os.MkdirAll(path.Dir(chunkPath), 0755)
+	if err != nil {
+		return
+	}
+
+	tmpPath := chunkPath + ".tmp"
+	file, err := os.Open(tmpPath, os.O_CREAT|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	err = saveChunk(file, chunk)
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+
+	return os.Rename(tmpPath, chunkPath)
+}
+
+// Chunks held in memory, for worlds built by code rather than read from disk
+// Chunks that were not put in the store are made by the generate function.  A
+// store hands out the same chunks every time, so it must not be shared
+// between chunk managers.
+type MemoryChunkStore struct {
+	chunks   map[uint64]*Chunk
+	generate func(x ChunkCoord, z ChunkCoord) *Chunk
+}
+
+// Create a store that makes missing chunks with generate, or with NewChunk
+// if generate is nil
+func NewMemoryChunkStore(generate func(x ChunkCoord, z ChunkCoord) *Chunk) *MemoryChunkStore {
+	if generate == nil {
+		generate = NewChunk
+	}
+	return &MemoryChunkStore{
+		chunks:   make(map[uint64]*Chunk),
+		generate: generate,
+	}
+}
+
+// Add a chunk, replacing any chunk at the same coordinates
+func (store *MemoryChunkStore) Put(chunk *Chunk) {
+	store.chunks[chunkKey(chunk.X, chunk.Z)] = chunk
+}
+
+func (store *MemoryChunkStore) LoadChunk(x ChunkCoord, z ChunkCoord) (chunk *Chunk, err os.Error) {
+	key := chunkKey(x, z)
+	chunk, ok := store.chunks[key]
+	if !ok {
+		chunk = store.generate(x, z)
+		store.chunks[key] = chunk
+	}
+	return
+}
+
+// Chunks are written as NBT and read back, as if they went through a file,
+// so that loading a saved chunk only gives back what saving it kept
+func (store *MemoryChunkStore) SaveChunk(chunk *Chunk) os.Error {
+	buf := &bytes.Buffer{}
+	err := saveChunk(buf, chunk)
+	if err != nil {
+		return err
+	}
+
+	saved, err := loadChunk(buf)
+	if err != nil {
+		return err
+	}
+	store.Put(saved)
+	return nil
+}
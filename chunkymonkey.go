@@ -2,33 +2,36 @@ package main
 
 import (
 	"os"
-	"path"
 	"flag"
 	"log"
-	"nbt"
+	"time"
 )
 
-// The player's starting position is loaded from level.dat for now
-var StartPosition XYZ
+var simulate = flag.Bool("simulate", false, "run the replays on a virtual clock as fast as possible, then exit")
 
-func loadStartPosition(worldPath string) {
-	file, err := os.Open(path.Join(worldPath, "level.dat"), os.O_RDONLY, 0)
-	if err != nil {
-		log.Exit("loadStartPosition: ", err.String())
+// Replay recordings without accepting clients
+func runSimulation(chunkManager *ChunkManager, level *Level) {
+	if *replay == "" {
+		log.Exit("--simulate needs recordings to --replay")
 	}
-
-	level, err := nbt.Read(file)
-	file.Close()
-	if err != nil {
-		log.Exit("loadStartPosition: ", err.String())
+	if *replayLoop {
+		log.Exit("--simulate cannot be combined with --replay-loop")
 	}
 
-	pos := level.Lookup("/Data/Player/Pos")
-	StartPosition = XYZ{
-		pos.(*nbt.List).Value[0].(*nbt.Double).Value,
-		pos.(*nbt.List).Value[1].(*nbt.Double).Value,
-		pos.(*nbt.List).Value[2].(*nbt.Double).Value,
-	}
+	start := time.Nanoseconds()
+	clock := NewVirtualClock()
+	game := NewGame(chunkManager, level, clock)
+	finished := StartReplays(game)
+	clock.Leave()
+	<-finished
+
+	// Let the main loop finish what the replays left behind
+	result := make(chan int64)
+	game.Enqueue(func(game *Game) { result <- game.tickCount })
+	ticks := <-result
+
+	log.Stderrf("Simulated %d ticks (%.1f seconds) in %.1f seconds", ticks,
+		float64(clock.Now())/1e9, float64(time.Nanoseconds()-start)/1e9)
 }
 
 func usage() {
@@ -40,6 +43,13 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	if *golden != "" {
+		if !RunGoldenCases() {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if flag.NArg() != 1 {
 		flag.Usage()
 		os.Exit(1)
@@ -47,8 +57,19 @@ func main() {
 
 	worldPath := flag.Arg(0)
 
-	loadStartPosition(worldPath)
-	chunkManager := NewChunkManager(worldPath)
-	game := NewGame(chunkManager)
+	level, err := LoadLevel(worldPath)
+	if err != nil {
+		log.Exit("LoadLevel: ", err.String())
+	}
+
+	chunkManager := NewChunkManager(NewDirChunkStore(worldPath))
+
+	if *simulate {
+		runSimulation(chunkManager, level)
+		return
+	}
+
+	game := NewGame(chunkManager, level, WallClock{})
+	StartReplays(game)
 	game.Serve(":25565")
 }
@@ -0,0 +1,192 @@
+// A Minecraft client library for bots, load tests and proxies
+
+package client
+
+import (
+	"os"
+	"net"
+	"sync"
+	"bytes"
+	"proto"
+)
+
+// Player digging status values
+const (
+	DigStarted = 0
+	DigDigging = 1
+	DigStopped = 2
+	DigBroken  = 3
+)
+
+// Returned when the server sends a disconnect packet while logging in
+type KickedError struct {
+	Reason string
+}
+
+func (err *KickedError) String() string {
+	return "kicked: " + err.Reason
+}
+
+type Client struct {
+	conn      net.Conn
+	codec     *proto.Codec
+	Username  string
+	EntityID  int32
+	MapSeed   int64
+	Dimension byte
+	writeLock sync.Mutex
+}
+
+// Connect to a server and log in
+func Dial(addr string, username string, version int32) (client *Client, err os.Error) {
+	conn, err := net.Dial("tcp", "", addr)
+	if err != nil {
+		return
+	}
+
+	client, err = Login(conn, username, version)
+	if err != nil {
+		conn.Close()
+	}
+	return
+}
+
+// Read a login reply packet, turning a disconnect into a KickedError
+func readReply(codec *proto.Codec, conn net.Conn, expected byte) (packet proto.Packet, err os.Error) {
+	packet, err = codec.ReadClientbound(conn)
+	if err != nil {
+		return
+	}
+
+	if disconnect, ok := packet.(*proto.DisconnectPacket); ok {
+		return nil, &KickedError{disconnect.Reason}
+	}
+	if packet.ID() != expected {
+		return nil, &proto.UnexpectedPacketError{expected, packet.ID()}
+	}
+	return
+}
+
+// Log in over an established connection
+func Login(conn net.Conn, username string, version int32) (client *Client, err os.Error) {
+	codec, err := proto.LookupCodec(version)
+	if err != nil {
+		return
+	}
+
+	c := &Client{conn: conn, codec: codec, Username: username}
+
+	err = c.Send(&proto.HandshakeRequestPacket{username})
+	if err != nil {
+		return
+	}
+	_, err = readReply(codec, conn, proto.PacketIDHandshakeReply)
+	if err != nil {
+		return
+	}
+
+	err = c.Send(&proto.LoginRequestPacket{ProtocolVersion: version, Username: username})
+	if err != nil {
+		return
+	}
+	packet, err := readReply(codec, conn, proto.PacketIDLoginReply)
+	if err != nil {
+		return
+	}
+
+	reply := packet.(*proto.LoginReplyPacket)
+	c.EntityID = reply.EntityID
+	c.MapSeed = reply.MapSeed
+	c.Dimension = reply.Dimension
+	return c, nil
+}
+
+// The protocol version spoken on this connection
+func (client *Client) Version() int32 {
+	return client.codec.Version
+}
+
+func (client *Client) Close() os.Error {
+	return client.conn.Close()
+}
+
+// Read the next packet sent by the server
+func (client *Client) ReadPacket() (packet proto.Packet, err os.Error) {
+	return client.codec.ReadClientbound(client.conn)
+}
+
+// Read packets and pass them to a handler until the connection fails
+func (client *Client) Run(handler ClientPacketHandler) (err os.Error) {
+	for {
+		packet, err := client.ReadPacket()
+		if err != nil {
+			return err
+		}
+
+		err = DispatchPacket(packet, handler)
+		if err != nil {
+			return err
+		}
+	}
+	panic("unreachable")
+}
+
+// Send a packet to the server
+// Packets are encoded before being written so that concurrent senders never
+// interleave partial packets.
+func (client *Client) Send(packet proto.Packet) (err os.Error) {
+	buf := &bytes.Buffer{}
+	err = client.codec.Write(buf, packet)
+	if err != nil {
+		return
+	}
+
+	client.writeLock.Lock()
+	defer client.writeLock.Unlock()
+	_, err = client.conn.Write(buf.Bytes())
+	return
+}
+
+func (client *Client) SendKeepAlive() os.Error {
+	return client.Send(&proto.KeepAlivePacket{})
+}
+
+func (client *Client) SendChatMessage(message string) os.Error {
+	return client.Send(&proto.ChatMessagePacket{message})
+}
+
+func (client *Client) SendFlying(flying bool) os.Error {
+	return client.Send(&proto.FlyingPacket{flying})
+}
+
+func (client *Client) SendPosition(x, y, stance, z float64, flying bool) os.Error {
+	return client.Send(&proto.PlayerPositionPacket{x, y, stance, z, flying})
+}
+
+func (client *Client) SendLook(rotation, pitch float32, flying bool) os.Error {
+	return client.Send(&proto.PlayerLookPacket{rotation, pitch, flying})
+}
+
+func (client *Client) SendPositionLook(x, y, stance, z float64, rotation, pitch float32, flying bool) os.Error {
+	return client.Send(&proto.PlayerPositionLookPacket{x, y, stance, z, rotation, pitch, flying})
+}
+
+func (client *Client) SendDigging(status byte, x int32, y byte, z int32, face byte) os.Error {
+	return client.Send(&proto.PlayerDiggingPacket{status, x, y, z, face})
+}
+
+func (client *Client) SendBlockPlacement(blockItemID int16, x int32, y byte, z int32, direction byte) os.Error {
+	return client.Send(&proto.PlayerBlockPlacementPacket{blockItemID, x, y, z, direction})
+}
+
+func (client *Client) SendHoldingChange(blockItemID int16) os.Error {
+	return client.Send(&proto.HoldingChangePacket{client.EntityID, blockItemID})
+}
+
+func (client *Client) SendArmAnimation(forward bool) os.Error {
+	return client.Send(&proto.ArmAnimationPacket{client.EntityID, forward})
+}
+
+func (client *Client) SendDisconnect(reason string) os.Error {
+	return client.Send(&proto.DisconnectPacket{reason})
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"io/ioutil"
+	"compress/zlib"
+	"proto"
+)
+
+// Callers must implement this interface to receive packets from the server
+// Embed IgnorePackets to implement only the packets of interest.
+type ClientPacketHandler interface {
+	PacketKeepAlive()
+	PacketChatMessage(message string)
+	PacketTimeUpdate(time int64)
+	PacketPlayerInventory(inventoryType int32, items []proto.ItemSlot)
+	PacketSpawnPosition(x, y, z int32)
+	PacketFlying(flying bool)
+	PacketPlayerPosition(x, y, stance, z float64, flying bool)
+	PacketPlayerLook(rotation, pitch float32, flying bool)
+	PacketPlayerPositionLook(x, y, stance, z float64, rotation, pitch float32, flying bool)
+	PacketHoldingChange(entityID int32, blockItemID int16)
+	PacketAddToInventory(itemID int16, count byte, life int16)
+	PacketArmAnimation(entityID int32, forward bool)
+	PacketNamedEntitySpawn(entityID int32, name string, x, y, z int32, rotation, pitch byte, currentItem int16)
+	PacketPickupSpawn(entityID int32, itemID int16, count byte, x, y, z int32, vx, vy, vz int8)
+	PacketCollectItem(collectedEntityID, collectorEntityID int32)
+	PacketAddObject(entityID int32, objectType byte, x, y, z int32)
+	PacketMobSpawn(entityID int32, mobType byte, x, y, z int32, rotation, pitch byte)
+	PacketEntityVelocity(entityID int32, vx, vy, vz int16)
+	PacketDestroyEntity(entityID int32)
+	PacketEntityRelativeMove(entityID int32, dx, dy, dz int8)
+	PacketEntityLook(entityID int32, rotation, pitch byte)
+	PacketEntityLookAndRelativeMove(entityID int32, dx, dy, dz int8, rotation, pitch byte)
+	PacketEntityTeleport(entityID int32, x, y, z int32, rotation, pitch byte)
+	PacketPreChunk(x, z int32, willSend bool)
+	PacketMapChunk(x int32, y int16, z int32, sizeX, sizeY, sizeZ byte, data []byte)
+	PacketBlockChange(x int32, y byte, z int32, blockType, blockMetadata byte)
+	PacketComplexEntity(x int32, y int16, z int32, payload []byte)
+	PacketDisconnect(reason string)
+}
+
+// A ClientPacketHandler that ignores all packets
+type IgnorePackets struct{}
+
+func (*IgnorePackets) PacketKeepAlive()                                                  {}
+func (*IgnorePackets) PacketChatMessage(message string)                                  {}
+func (*IgnorePackets) PacketTimeUpdate(time int64)                                       {}
+func (*IgnorePackets) PacketPlayerInventory(inventoryType int32, items []proto.ItemSlot) {}
+func (*IgnorePackets) PacketSpawnPosition(x, y, z int32)                                 {}
+func (*IgnorePackets) PacketFlying(flying bool)                                          {}
+func (*IgnorePackets) PacketPlayerPosition(x, y, stance, z float64, flying bool)         {}
+func (*IgnorePackets) PacketPlayerLook(rotation, pitch float32, flying bool)             {}
+func (*IgnorePackets) PacketPlayerPositionLook(x, y, stance, z float64, rotation, pitch float32, flying bool) {
+}
+func (*IgnorePackets) PacketHoldingChange(entityID int32, blockItemID int16)     {}
+func (*IgnorePackets) PacketAddToInventory(itemID int16, count byte, life int16) {}
+func (*IgnorePackets) PacketArmAnimation(entityID int32, forward bool)           {}
+func (*IgnorePackets) PacketNamedEntitySpawn(entityID int32, name string, x, y, z int32, rotation, pitch byte, currentItem int16) {
+}
+func (*IgnorePackets) PacketPickupSpawn(entityID int32, itemID int16, count byte, x, y, z int32, vx, vy, vz int8) {
+}
+func (*IgnorePackets) PacketCollectItem(collectedEntityID, collectorEntityID int32)   {}
+func (*IgnorePackets) PacketAddObject(entityID int32, objectType byte, x, y, z int32) {}
+func (*IgnorePackets) PacketMobSpawn(entityID int32, mobType byte, x, y, z int32, rotation, pitch byte) {
+}
+func (*IgnorePackets) PacketEntityVelocity(entityID int32, vx, vy, vz int16)    {}
+func (*IgnorePackets) PacketDestroyEntity(entityID int32)                       {}
+func (*IgnorePackets) PacketEntityRelativeMove(entityID int32, dx, dy, dz int8) {}
+func (*IgnorePackets) PacketEntityLook(entityID int32, rotation, pitch byte)    {}
+func (*IgnorePackets) PacketEntityLookAndRelativeMove(entityID int32, dx, dy, dz int8, rotation, pitch byte) {
+}
+func (*IgnorePackets) PacketEntityTeleport(entityID int32, x, y, z int32, rotation, pitch byte) {
+}
+func (*IgnorePackets) PacketPreChunk(x, z int32, willSend bool) {}
+func (*IgnorePackets) PacketMapChunk(x int32, y int16, z int32, sizeX, sizeY, sizeZ byte, data []byte) {
+}
+func (*IgnorePackets) PacketBlockChange(x int32, y byte, z int32, blockType, blockMetadata byte) {
+}
+func (*IgnorePackets) PacketComplexEntity(x int32, y int16, z int32, payload []byte) {}
+func (*IgnorePackets) PacketDisconnect(reason string)                                {}
+
+// Inflate the block data of a map chunk packet
+func DecompressChunk(compressed []byte) (data []byte, err os.Error) {
+	reader, err := zlib.NewReader(bytes.NewBuffer(compressed))
+	if err != nil {
+		return
+	}
+
+	data, err = ioutil.ReadAll(reader)
+	reader.Close()
+	return
+}
+
+// Pass a packet received from a server to the handler
+func DispatchPacket(packet proto.Packet, handler ClientPacketHandler) (err os.Error) {
+	switch p := packet.(type) {
+	case *proto.KeepAlivePacket:
+		handler.PacketKeepAlive()
+	case *proto.ChatMessagePacket:
+		handler.PacketChatMessage(p.Message)
+	case *proto.TimeUpdatePacket:
+		handler.PacketTimeUpdate(p.Time)
+	case *proto.PlayerInventoryPacket:
+		handler.PacketPlayerInventory(p.InventoryType, p.Items)
+	case *proto.SpawnPositionPacket:
+		handler.PacketSpawnPosition(p.X, p.Y, p.Z)
+	case *proto.FlyingPacket:
+		handler.PacketFlying(p.Flying)
+	case *proto.PlayerPositionPacket:
+		handler.PacketPlayerPosition(p.X, p.Y, p.Stance, p.Z, p.Flying)
+	case *proto.PlayerLookPacket:
+		handler.PacketPlayerLook(p.Rotation, p.Pitch, p.Flying)
+	case *proto.PlayerPositionLookPacket:
+		handler.PacketPlayerPositionLook(p.X, p.Y, p.Stance, p.Z, p.Rotation, p.Pitch, p.Flying)
+	case *proto.HoldingChangePacket:
+		handler.PacketHoldingChange(p.EntityID, p.BlockItemID)
+	case *proto.AddToInventoryPacket:
+		handler.PacketAddToInventory(p.ItemID, p.Count, p.Life)
+	case *proto.ArmAnimationPacket:
+		handler.PacketArmAnimation(p.EntityID, p.Forward)
+	case *proto.NamedEntitySpawnPacket:
+		handler.PacketNamedEntitySpawn(p.EntityID, p.Name, p.X, p.Y, p.Z, p.Rotation, p.Pitch, p.CurrentItem)
+	case *proto.PickupSpawnPacket:
+		handler.PacketPickupSpawn(p.EntityID, p.ItemID, p.Count, p.X, p.Y, p.Z, p.VX, p.VY, p.VZ)
+	case *proto.CollectItemPacket:
+		handler.PacketCollectItem(p.CollectedEntityID, p.CollectorEntityID)
+	case *proto.AddObjectPacket:
+		handler.PacketAddObject(p.EntityID, p.Type, p.X, p.Y, p.Z)
+	case *proto.MobSpawnPacket:
+		handler.PacketMobSpawn(p.EntityID, p.Type, p.X, p.Y, p.Z, p.Rotation, p.Pitch)
+	case *proto.EntityVelocityPacket:
+		handler.PacketEntityVelocity(p.EntityID, p.VX, p.VY, p.VZ)
+	case *proto.DestroyEntityPacket:
+		handler.PacketDestroyEntity(p.EntityID)
+	case *proto.EntityRelativeMovePacket:
+		handler.PacketEntityRelativeMove(p.EntityID, p.DX, p.DY, p.DZ)
+	case *proto.EntityLookPacket:
+		handler.PacketEntityLook(p.EntityID, p.Rotation, p.Pitch)
+	case *proto.EntityLookAndRelativeMovePacket:
+		handler.PacketEntityLookAndRelativeMove(p.EntityID, p.DX, p.DY, p.DZ, p.Rotation, p.Pitch)
+	case *proto.EntityTeleportPacket:
+		handler.PacketEntityTeleport(p.EntityID, p.X, p.Y, p.Z, p.Rotation, p.Pitch)
+	case *proto.PreChunkPacket:
+		handler.PacketPreChunk(p.X, p.Z, p.WillSend)
+	case *proto.MapChunkPacket:
+		var data []byte
+		data, err = DecompressChunk(p.CompressedData)
+		if err != nil {
+			return
+		}
+		handler.PacketMapChunk(p.X, p.Y, p.Z, p.SizeX, p.SizeY, p.SizeZ, data)
+	case *proto.BlockChangePacket:
+		handler.PacketBlockChange(p.X, p.Y, p.Z, p.BlockType, p.BlockMetadata)
+	case *proto.ComplexEntityPacket:
+		handler.PacketComplexEntity(p.X, p.Y, p.Z, p.Payload)
+	case *proto.DisconnectPacket:
+		handler.PacketDisconnect(p.Reason)
+	default:
+		err = os.NewError(fmt.Sprintf("unhandled packet type %#x", packet.ID()))
+	}
+	return
+}
@@ -0,0 +1,225 @@
+// Sources of time for the main loop and replayed connections
+
+package main
+
+import (
+	"sync"
+	"time"
+	"container/heap"
+)
+
+type Clock interface {
+	// The current time in nanoseconds
+	Now() int64
+
+	// Block until the time is at least t.  Returns false if cancel is
+	// closed first.
+	WaitUntil(t int64, cancel chan bool) bool
+
+	// Goroutines that wait on the clock join it while they run, so that a
+	// virtual clock knows when all of them are waiting
+	Join()
+	Leave()
+}
+
+// The real time
+type WallClock struct{}
+
+func (WallClock) Now() int64 {
+	return time.Nanoseconds()
+}
+
+func (WallClock) WaitUntil(t int64, cancel chan bool) bool {
+	delay := t - time.Nanoseconds()
+	if delay <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-cancel:
+	}
+	return false
+}
+
+func (WallClock) Join() {
+}
+
+func (WallClock) Leave() {
+}
+
+type waiter struct {
+	due   int64
+	seq   int64 // orders waiters that are due at the same time
+	index int   // position in the heap
+	wake  chan bool
+}
+
+// waiterQueue is a min-heap of waiters ordered by due time
+type waiterQueue []*waiter
+
+func (q waiterQueue) Len() int {
+	return len(q)
+}
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].due == q[j].due {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due < q[j].due
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x interface{}) {
+	old := *q
+	n := len(old)
+	if n == cap(old) {
+		grown := make(waiterQueue, n, 2*n+1)
+		copy(grown, old)
+		old = grown
+	}
+	*q = old[0 : n+1]
+	w := x.(*waiter)
+	w.index = n
+	(*q)[n] = w
+}
+
+func (q *waiterQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return w
+}
+
+// A clock that only moves when told to
+// Time stands still while any joined goroutine is running.  Once all of them
+// are waiting, the main loop wakes them one at a time or advances the time
+// straight to the next event, so a simulation runs as fast as possible and
+// the same way every time.
+type VirtualClock struct {
+	lock         sync.Mutex
+	now          int64
+	participants int
+	waiters      waiterQueue
+	nextSeq      int64
+	changed      chan bool
+}
+
+// The creator of a virtual clock holds it still until it calls Leave, so that
+// goroutines started during setup can join before time moves
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{
+		participants: 1,
+		changed:      make(chan bool, 1),
+	}
+}
+
+func (clock *VirtualClock) Now() int64 {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+// Signal that the clock may have become idle
+// This must be called with the lock held.
+func (clock *VirtualClock) notify() {
+	select {
+	case clock.changed <- true:
+	default: // already pending
+	}
+}
+
+func (clock *VirtualClock) WaitUntil(t int64, cancel chan bool) bool {
+	clock.lock.Lock()
+	if t <= clock.now {
+		clock.lock.Unlock()
+		return true
+	}
+	w := &waiter{due: t, seq: clock.nextSeq, wake: make(chan bool, 1)}
+	clock.nextSeq++
+	heap.Push(&clock.waiters, w)
+	clock.notify()
+	clock.lock.Unlock()
+
+	select {
+	case <-w.wake:
+		return true
+	case <-cancel:
+	}
+
+	clock.lock.Lock()
+	if w.index >= 0 {
+		heap.Remove(&clock.waiters, w.index)
+	}
+	clock.lock.Unlock()
+	return false
+}
+
+func (clock *VirtualClock) Join() {
+	clock.lock.Lock()
+	clock.participants++
+	clock.lock.Unlock()
+}
+
+func (clock *VirtualClock) Leave() {
+	clock.lock.Lock()
+	clock.participants--
+	clock.notify()
+	clock.lock.Unlock()
+}
+
+// Receives a value when the clock may have become idle
+func (clock *VirtualClock) Changed() chan bool {
+	return clock.changed
+}
+
+// True if every joined goroutine is waiting for the time to advance
+func (clock *VirtualClock) Idle() bool {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return len(clock.waiters) >= clock.participants
+}
+
+// The time the first waiting goroutine is due to wake
+func (clock *VirtualClock) NextWakeup() (t int64, ok bool) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	if len(clock.waiters) == 0 {
+		return 0, false
+	}
+	return clock.waiters[0].due, true
+}
+
+// Move the time forward
+func (clock *VirtualClock) AdvanceTo(t int64) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	if t > clock.now {
+		clock.now = t
+	}
+}
+
+// Wake the first goroutine that is due, returning false if none are
+// The woken goroutine counts as running from here on, so the clock is not
+// idle again until it waits once more.
+func (clock *VirtualClock) WakeNext() bool {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	if len(clock.waiters) == 0 || clock.waiters[0].due > clock.now {
+		return false
+	}
+
+	w := heap.Pop(&clock.waiters).(*waiter)
+	w.index = -1
+	w.wake <- true
+	return true
+}
@@ -1,39 +1,232 @@
+// Entities are the things in the world that are not blocks
+
 package main
 
+import (
+	"io"
+	"os"
+	"sort"
+	"nbt"
+)
+
 type EntityID int32
 
+// The state shared by all kinds of entity
 type Entity struct {
-	EntityID EntityID
+	EntityID    EntityID
+	position    XYZ // the centre of the bottom of the bounding box
+	velocity    XYZ // in blocks per tick
+	orientation Orientation
+
+	// Size of the bounding box, in blocks
+	width  float64
+	height float64
+
+	// The chunk the entity is a member of, kept up to date by ChunkManager
+	chunkX, chunkZ ChunkCoord
+
+	// The entity as loaded from its chunk, so that tags we do not model are
+	// kept when it is saved.  Nil for entities that were never saved.
+	data *nbt.Compound
+}
+
+// Players, dropped items, mobs, arrows, minecarts and every other kind of
+// entity implement this interface.  Kinds embed Entity for their common
+// state.
+type EntityObject interface {
+	GetEntity() *Entity
+
+	// Run the entity's behaviour for one tick.  This is called from the main
+	// loop.
+	Tick(game *Game)
+
+	// Write the packet that makes the entity appear for a client
+	WriteSpawn(writer io.Writer) os.Error
+}
+
+// Entities that are saved with the chunk they are in, which is all kinds but
+// players
+type SavedEntity interface {
+	EntityObject
+	SaveNBT() *nbt.Compound
+}
+
+func (entity *Entity) GetEntity() *Entity {
+	return entity
+}
+
+// The corners of the entity's bounding box
+func (entity *Entity) BoundingBox() (min XYZ, max XYZ) {
+	min = XYZ{entity.position.x - entity.width/2, entity.position.y, entity.position.z - entity.width/2}
+	max = XYZ{entity.position.x + entity.width/2, entity.position.y + entity.height, entity.position.z + entity.width/2}
+	return
+}
+
+// True if the bounding boxes of two entities overlap
+func (entity *Entity) Intersects(other *Entity) bool {
+	return entity.Near(other, 0)
+}
+
+// True if the bounding boxes of two entities are closer than distance along
+// every axis
+func (entity *Entity) Near(other *Entity, distance float64) bool {
+	min, max := entity.BoundingBox()
+	otherMin, otherMax := other.BoundingBox()
+	return min.x-distance < otherMax.x && max.x+distance > otherMin.x &&
+		min.y-distance < otherMax.y && max.y+distance > otherMin.y &&
+		min.z-distance < otherMax.z && max.z+distance > otherMin.z
+}
+
+// Read the tags common to all entities
+func (entity *Entity) loadNBT(data *nbt.Compound) {
+	entity.data = data
+	entity.position, _ = lookupXYZ(data, "Pos")
+	entity.velocity, _ = lookupXYZ(data, "Motion")
+	entity.orientation, _ = lookupOrientation(data, "Rotation")
+}
+
+// Update the tags common to all entities
+func (entity *Entity) saveNBT(id string) *nbt.Compound {
+	if entity.data == nil {
+		entity.data = nbt.NewCompound()
+	}
+	data := entity.data
+	data.Set("id", &nbt.String{id})
+	data.Set("Pos", newXYZList(&entity.position))
+	data.Set("Motion", newXYZList(&entity.velocity))
+	data.Set("Rotation", newOrientationList(&entity.orientation))
+	return data
+}
+
+// Create an entity from its NBT representation
+// Returns nil for kinds of entity we do not know.
+func loadEntity(data *nbt.Compound) (object SavedEntity) {
+	id := lookupString(data, "id")
+	switch id {
+	case "Item":
+		item := NewItemEntity(lookupShort(data, "Item/id"), byte(lookupByte(data, "Item/Count")), &XYZ{}, &XYZ{})
+		item.age = int64(lookupShort(data, "Age"))
+		object = item
+	case "Minecart":
+		// Minecarts have a type tag that tells the kinds apart
+		object = NewObjectEntity(ObjectMinecart+byte(lookupInt(data, "Type")), &XYZ{})
+	default:
+		if mobType, ok := mobTypeByName(id); ok {
+			object = NewMob(mobType, &XYZ{})
+		} else if objectType, ok := objectTypeByName(id); ok {
+			object = NewObjectEntity(objectType, &XYZ{})
+		} else {
+			return nil
+		}
+	}
+
+	object.GetEntity().loadNBT(data)
+	return
 }
 
+type entityIDs []EntityID
+
+func (ids entityIDs) Len() int {
+	return len(ids)
+}
+
+func (ids entityIDs) Less(i, j int) bool {
+	return ids[i] < ids[j]
+}
+
+func (ids entityIDs) Swap(i, j int) {
+	ids[i], ids[j] = ids[j], ids[i]
+}
+
+// EntityManager holds every entity in the game by ID
 type EntityManager struct {
 	nextEntityID EntityID
-	entities     map[EntityID]*Entity
+	entities     map[EntityID]EntityObject
+	reserved     map[EntityID]bool // IDs of entities that have not been added yet
 }
 
-// Allocate and assign a new entity ID
-func (mgr *EntityManager) AddEntity(entity *Entity) {
+// Search for the next free ID
+func (mgr *EntityManager) allocate() EntityID {
 	// EntityManager starts initialized to zero
 	if mgr.entities == nil {
-		mgr.entities = make(map[EntityID]*Entity)
+		mgr.entities = make(map[EntityID]EntityObject)
+		mgr.reserved = make(map[EntityID]bool)
 	}
 
-	// Search for next free ID
 	entityID := mgr.nextEntityID
-	_, exists := mgr.entities[entityID]
-	for exists {
+	for {
+		_, exists := mgr.entities[entityID]
+		if !exists && !mgr.reserved[entityID] {
+			break
+		}
 		entityID++
 		if entityID == mgr.nextEntityID {
 			panic("EntityID space exhausted")
 		}
-		_, exists = mgr.entities[entityID]
 	}
 
-	entity.EntityID = entityID
-	mgr.entities[entityID] = entity
 	mgr.nextEntityID = entityID + 1
+	return entityID
+}
+
+// Allocate and assign a new entity ID
+func (mgr *EntityManager) AddEntity(object EntityObject) {
+	entityID := mgr.allocate()
+	object.GetEntity().EntityID = entityID
+	mgr.entities[entityID] = object
+}
+
+// Allocate an entity ID for an entity that is added later
+// Clients are told their player's entity ID when they log in, before the
+// player joins the game.
+func (mgr *EntityManager) ReserveEntityID() EntityID {
+	entityID := mgr.allocate()
+	mgr.reserved[entityID] = true
+	return entityID
 }
 
-func (mgr *EntityManager) RemoveEntity(entity *Entity) {
-	mgr.entities[entity.EntityID] = nil, false
+// Free a reserved entity ID that will not be used after all
+func (mgr *EntityManager) ReleaseEntityID(entityID EntityID) {
+	mgr.reserved[entityID] = false, false
+}
+
+// Add an entity under the ID reserved for it
+func (mgr *EntityManager) AddReservedEntity(object EntityObject) {
+	entityID := object.GetEntity().EntityID
+	if !mgr.reserved[entityID] {
+		panic("entity ID was not reserved")
+	}
+	mgr.reserved[entityID] = false, false
+	mgr.entities[entityID] = object
+}
+
+func (mgr *EntityManager) RemoveEntity(object EntityObject) {
+	mgr.entities[object.GetEntity().EntityID] = nil, false
+}
+
+// Look up an entity, returning nil if there is no entity with the ID
+func (mgr *EntityManager) Get(entityID EntityID) EntityObject {
+	return mgr.entities[entityID]
+}
+
+// All entities in order of ID, so that they can be visited in the same order
+// on every run of a simulation
+func (mgr *EntityManager) Entities() []EntityObject {
+	return sortedEntities(mgr.entities)
+}
+
+// The entities in a map in order of ID
+func sortedEntities(entities map[EntityID]EntityObject) []EntityObject {
+	ids := make(entityIDs, 0, len(entities))
+	for id := range entities {
+		ids = ids[0 : len(ids)+1]
+		ids[len(ids)-1] = id
+	}
+	sort.Sort(ids)
+
+	objects := make([]EntityObject, len(ids))
+	for i, id := range ids {
+		objects[i] = entities[id]
+	}
+	return objects
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+// Reserved IDs are not handed to other entities until they are released
+func TestReserveEntityID(t *testing.T) {
+	mgr := &EntityManager{}
+	reserved := mgr.ReserveEntityID()
+
+	item := NewItemEntity(BlockDirt, 1, &XYZ{}, &XYZ{})
+	mgr.AddEntity(item)
+	if item.EntityID == reserved {
+		t.Fatalf("item was given the reserved ID %d", reserved)
+	}
+
+	player := newTestPlayer(reserved, 0, 0)
+	mgr.AddReservedEntity(player)
+	if mgr.Get(reserved) != player {
+		t.Errorf("player missing under its reserved ID %d", reserved)
+	}
+
+	released := mgr.ReserveEntityID()
+	mgr.ReleaseEntityID(released)
+	mgr.nextEntityID = released
+	mob := NewMob(MobPig, &XYZ{})
+	mgr.AddEntity(mob)
+	if mob.EntityID != released {
+		t.Errorf("mob got ID %d instead of the released ID %d", mob.EntityID, released)
+	}
+}
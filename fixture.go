@@ -0,0 +1,93 @@
+// Worlds built in memory
+//
+// Fixtures give the game a world without any files on disk, so that golden
+// checks and experiments always start from the same known state.
+
+package main
+
+import (
+	"proto"
+)
+
+// A chunk filled with blockType below height
+func NewFlatChunk(x ChunkCoord, z ChunkCoord, height int, blockType byte) *Chunk {
+	chunk := NewChunk(x, z)
+	for bx := 0; bx < ChunkSizeX; bx++ {
+		for bz := 0; bz < ChunkSizeZ; bz++ {
+			for y := 0; y < height; y++ {
+				chunk.SetBlock(bx, y, bz, blockType)
+			}
+		}
+	}
+	return chunk
+}
+
+// A flat chunk with a chest, a sign and entities on top
+// The entities are a pig, a dropped item and a storage minecart, so that all
+// a chunk holds besides its blocks can be checked when it is saved, loaded and
+// sent.
+func NewFurnishedChunk(x ChunkCoord, z ChunkCoord, height int, blockType byte) *Chunk {
+	chunk := NewFlatChunk(x, z, height, blockType)
+	originX, originZ := float64(x)*ChunkSizeX, float64(z)*ChunkSizeZ
+
+	chest := &Chest{items: []ContainerSlot{
+		ContainerSlot{0, proto.ItemSlot{BlockCobblestone, 10, 0}},
+		ContainerSlot{13, proto.ItemSlot{BlockDirt, 64, 0}},
+	}}
+	chest.x, chest.y, chest.z = int32(x)*ChunkSizeX+8, height, int32(z)*ChunkSizeZ+2
+	chunk.SetBlock(8, height, 2, BlockChest)
+	chunk.SetTileEntity(chest)
+
+	sign := &Sign{text: [4]string{"Welcome", "to the", "furnished", "chunk"}}
+	sign.x, sign.y, sign.z = int32(x)*ChunkSizeX+10, height, int32(z)*ChunkSizeZ+2
+	chunk.SetBlock(10, height, 2, BlockSignPost)
+	chunk.SetTileEntity(sign)
+
+	y := float64(height)
+	chunk.pendingEntities = []SavedEntity{
+		NewMob(MobPig, &XYZ{originX + 4.5, y, originZ + 8.5}),
+		NewItemEntity(BlockDirt, 3, &XYZ{originX + 12.5, y, originZ + 8.5}, &XYZ{}),
+		NewObjectEntity(ObjectStorageCart, &XYZ{originX + 8.5, y, originZ + 12.5}),
+	}
+	return chunk
+}
+
+// A world of flat chunks stretching in every direction
+func NewFlatWorld(height int, blockType byte) *MemoryChunkStore {
+	return NewMemoryChunkStore(func(x ChunkCoord, z ChunkCoord) *Chunk {
+		return NewFlatChunk(x, z, height, blockType)
+	})
+}
+
+// A world of air apart from a single chunk
+func NewSingleChunkWorld(chunk *Chunk) *MemoryChunkStore {
+	store := NewMemoryChunkStore(nil)
+	store.Put(chunk)
+	return store
+}
+
+// Change the block at world block coordinates
+func (store *MemoryChunkStore) SetBlock(x int32, y int, z int32, blockType byte) {
+	// Shifting rounds towards negative infinity, unlike division
+	chunk, _ := store.LoadChunk(ChunkCoord(x>>4), ChunkCoord(z>>4))
+	chunk.SetBlock(int(x&(ChunkSizeX-1)), y, int(z&(ChunkSizeZ-1)), blockType)
+}
+
+// Lay out blocks in a horizontal layer from a picture of it
+// Each string in rows is a row of blocks along the x axis, starting at (x, y, z)
+// and with the following rows at increasing z.  Each character is looked up in
+// legend to find its block type; characters missing from legend leave the
+// block unchanged.  For example, a stone ring around a dirt block:
+//
+//	store.SetLayer(0, 64, 0, []string{"SSS", "SDS", "SSS"},
+//		map[byte]byte{'S': BlockStone, 'D': BlockDirt})
+func (store *MemoryChunkStore) SetLayer(x int32, y int, z int32, rows []string, legend map[byte]byte) {
+	for dz, row := range rows {
+		for dx := 0; dx < len(row); dx++ {
+			blockType, ok := legend[row[dx]]
+			if ok {
+				store.SetBlock(x+int32(dx), y, z+int32(dz), blockType)
+			}
+		}
+	}
+}
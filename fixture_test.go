@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func height(chunk *Chunk, x int, z int) int {
+	return int(chunk.HeightMap[z*ChunkSizeX+x])
+}
+
+// The height map follows blocks placed on top of a column and dug out of it
+func TestSetBlockHeightMap(t *testing.T) {
+	store := NewSingleChunkWorld(NewFlatChunk(0, 0, 64, BlockStone))
+	chunk, _ := store.LoadChunk(0, 0)
+	if h := height(chunk, 3, 4); h != 64 {
+		t.Fatalf("flat chunk has height %d, expected 64", h)
+	}
+
+	store.SetBlock(3, 70, 4, BlockDirt)
+	if h := height(chunk, 3, 4); h != 71 {
+		t.Errorf("height %d after placing a block at y=70, expected 71", h)
+	}
+	if h := height(chunk, 4, 3); h != 64 {
+		t.Errorf("height %d next to the placed block, expected 64", h)
+	}
+
+	// The height drops to the next solid block below
+	store.SetBlock(3, 70, 4, BlockAir)
+	if h := height(chunk, 3, 4); h != 64 {
+		t.Errorf("height %d after removing the block, expected 64", h)
+	}
+	store.SetBlock(3, 63, 4, BlockAir)
+	store.SetBlock(3, 62, 4, BlockAir)
+	if h := height(chunk, 3, 4); h != 62 {
+		t.Errorf("height %d after digging two blocks down, expected 62", h)
+	}
+
+	// Digging below the top leaves the height alone
+	store.SetBlock(5, 10, 5, BlockAir)
+	if h := height(chunk, 5, 5); h != 64 {
+		t.Errorf("height %d after digging a cave, expected 64", h)
+	}
+}
+
+// Layers are laid out along x, then z, and may cross into other chunks
+func TestSetLayer(t *testing.T) {
+	store := NewSingleChunkWorld(NewChunk(0, 0))
+	store.SetLayer(-1, 64, -1, []string{"SSS", "SD.", "S S"},
+		map[byte]byte{'S': BlockStone, 'D': BlockDirt})
+
+	chunk, _ := store.LoadChunk(0, 0)
+	if blockType := chunk.Block(0, 64, 0); blockType != BlockDirt {
+		t.Errorf("block %d at the centre, expected dirt", blockType)
+	}
+	if blockType := chunk.Block(1, 64, 1); blockType != BlockStone {
+		t.Errorf("block %d at a corner, expected stone", blockType)
+	}
+	if blockType := chunk.Block(0, 64, 1); blockType != BlockAir {
+		t.Errorf("block %d under a space, expected air", blockType)
+	}
+	if blockType := chunk.Block(1, 64, 0); blockType != BlockAir {
+		t.Errorf("block %d under a character missing from the legend, expected air", blockType)
+	}
+
+	corner, _ := store.LoadChunk(-1, -1)
+	if blockType := corner.Block(15, 64, 15); blockType != BlockStone {
+		t.Errorf("block %d in chunk (-1, -1), expected stone", blockType)
+	}
+	if h := height(corner, 15, 15); h != 65 {
+		t.Errorf("height %d in chunk (-1, -1), expected 65", h)
+	}
+}
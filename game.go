@@ -1,11 +1,14 @@
 package main
 
 import (
+	"os"
 	"bytes"
 	"log"
 	"net"
 	"time"
 	"fmt"
+	"flag"
+	"proto"
 )
 
 type XYZ struct {
@@ -17,31 +20,119 @@ type Orientation struct {
 	pitch    float32
 }
 
+const (
+	// The game world advances in fixed steps called ticks
+	TicksPerSecond = 20
+	TickLength     = 1000000000 / TicksPerSecond // nanoseconds
+
+	// When the main loop falls further behind than this, the missed ticks
+	// are skipped instead of being run back-to-back
+	maxTickBacklog = TicksPerSecond
+
+	// Interval between writing level.dat back to disk, in ticks
+	levelSaveInterval = 60 * TicksPerSecond
+
+	// Interval between writing changed chunks back to disk, in ticks
+	chunkSaveInterval = 60 * TicksPerSecond
+
+	// Interval between keep-alive packets sent to clients, in ticks
+	keepAliveInterval = 5 * TicksPerSecond
+)
+
+var timeUpdateInterval = flag.Int("time-update-interval", TicksPerSecond, "ticks between time updates sent to clients")
+var playerTimeout = flag.Int("player-timeout", 30, "seconds of silence after which a player is disconnected")
+var loginTimeout = flag.Int("login-timeout", 10, "seconds a client may take to log in")
+
 type Game struct {
 	chunkManager  *ChunkManager
+	level         *Level
 	mainQueue     chan func(*Game)
 	entityManager EntityManager
+	entityTracker EntityTracker
 	players       map[EntityID]*Player
 	time          int64
+	scheduler     Scheduler
+	clock         Clock
+	tickCount     int64 // ticks run since the server started
+	nextTickTime  int64 // clock time the next tick is due, in nanoseconds
+	avgTickLength int64 // moving average of tick run time, in nanoseconds
+}
+
+// The message shown to a client whose login failed, or "" if the client is
+// not listening anymore
+func loginKickReason(err os.Error) string {
+	switch e := err.(type) {
+	case *proto.UnsupportedVersionError:
+		if e.Version < proto.OldestProtocolVersion {
+			return "Outdated client!"
+		}
+		return "Outdated server!"
+	case *proto.UnexpectedPacketError:
+		return "Protocol error during login"
+	case net.Error:
+		if e.Timeout() {
+			return "Took too long to log in"
+		}
+	}
+	return ""
+}
+
+// Explain a failed login to the client and drop the connection
+func rejectLogin(conn net.Conn, err os.Error) {
+	log.Stderr("Login from ", conn.RemoteAddr(), " failed: ", err.String())
+
+	reason := loginKickReason(err)
+	if reason != "" {
+		WriteDisconnect(conn, reason)
+	}
+	conn.Close()
 }
 
 func (game *Game) Login(conn net.Conn) {
+	// Half-open connections must not hang around forever.  The player's
+	// transmit and receive loops replace this timeout after login.
+	conn.SetTimeout(int64(*loginTimeout) * 1e9)
+
 	username, err := ReadHandshake(conn)
 	if err != nil {
-		log.Stderr("ReadHandshake: ", err.String())
+		rejectLogin(conn, err)
 		return
 	}
 	log.Stderr("Client ", conn.RemoteAddr(), " connected as ", username)
-	WriteHandshake(conn, "-")
 
-	_, _, err = ReadLogin(conn)
+	err = WriteHandshake(conn, "-")
+	if err != nil {
+		rejectLogin(conn, err)
+		return
+	}
+
+	codec, _, _, err := ReadLogin(conn)
+	if err != nil {
+		rejectLogin(conn, err)
+		return
+	}
+	RecordLogin(conn, username)
+
+	entityID := game.reserveEntityID()
+	err = codec.WriteLogin(conn, int32(entityID), game.level.RandomSeed, 0)
 	if err != nil {
-		log.Stderr("ReadLogin: ", err.String())
+		game.Enqueue(func(game *Game) { game.entityManager.ReleaseEntityID(entityID) })
+		rejectLogin(conn, err)
 		return
 	}
-	WriteLogin(conn)
 
-	StartPlayer(game, conn, username)
+	StartPlayer(game, conn, codec, username, entityID)
+}
+
+// Reserve the entity ID of a player that is logging in
+// The login reply tells the client its ID, so it is needed before the player
+// can join the game.
+func (game *Game) reserveEntityID() EntityID {
+	result := make(chan EntityID, 1)
+	game.Enqueue(func(game *Game) {
+		result <- game.entityManager.ReserveEntityID()
+	})
+	return <-result
 }
 
 func (game *Game) Serve(addr string) {
@@ -62,17 +153,37 @@ func (game *Game) Serve(addr string) {
 	}
 }
 
+// Put an entity into the world
+// It is spawned for the players in range at the next tracker update.
+func (game *Game) AddEntity(object EntityObject) {
+	game.entityManager.AddEntity(object)
+	game.placeEntity(object)
+}
+
+// Put an entity that has an ID into the chunks and the tracker
+func (game *Game) placeEntity(object EntityObject) {
+	game.chunkManager.AddEntity(object)
+	game.entityTracker.Add(object, game.tickCount)
+}
+
+// Take an entity out of the world and despawn it for its viewers
+func (game *Game) RemoveEntity(object EntityObject) {
+	game.entityTracker.Remove(object)
+	game.chunkManager.RemoveEntity(object)
+	game.entityManager.RemoveEntity(object)
+}
+
+// Add a player under the entity ID reserved when it logged in
 func (game *Game) AddPlayer(player *Player) {
-	game.entityManager.AddEntity(&player.Entity)
+	game.entityManager.AddReservedEntity(player)
+	game.placeEntity(player)
 	game.players[player.EntityID] = player
 	game.SendChatMessage(fmt.Sprintf("%s has joined", player.name))
-	game.chunkManager.AddPlayer(player)
 }
 
 func (game *Game) RemovePlayer(player *Player) {
-	game.chunkManager.RemovePlayer(player)
+	game.RemoveEntity(player)
 	game.players[player.EntityID] = nil, false
-	game.entityManager.RemoveEntity(&player.Entity)
 	game.SendChatMessage(fmt.Sprintf("%s has left", player.name))
 }
 
@@ -97,17 +208,91 @@ func (game *Game) Enqueue(f func(*Game)) {
 }
 
 func (game *Game) mainLoop() {
+	game.nextTickTime = game.clock.Now()
+
+	if clock, ok := game.clock.(*VirtualClock); ok {
+		game.simulationLoop(clock)
+		return
+	}
+
+	ticker := time.NewTicker(TickLength)
 	for {
-		f := <-game.mainQueue
-		f(game)
+		select {
+		case f := <-game.mainQueue:
+			f(game)
+		case <-ticker.C:
+			game.runDueTicks()
+		}
 	}
 }
 
-func (game *Game) timer() {
-	ticker := time.NewTicker(1000000000) // 1 sec
+// Run the game as fast as possible under a virtual clock
+// Time only advances once every replayed connection is waiting for its next
+// packet and the main queue is empty, so a simulation behaves the same on
+// every run however fast the machine is.
+func (game *Game) simulationLoop(clock *VirtualClock) {
 	for {
-		<-ticker.C
-		game.Enqueue(func(game *Game) { game.tick() })
+		select {
+		case f := <-game.mainQueue:
+			f(game)
+			continue
+		default:
+		}
+
+		if !clock.Idle() {
+			select {
+			case f := <-game.mainQueue:
+				f(game)
+			case <-clock.Changed():
+			}
+			continue
+		}
+
+		// Wake connections one at a time so that their packets are
+		// always handled in the same order
+		if clock.WakeNext() {
+			continue
+		}
+
+		wakeup, ok := clock.NextWakeup()
+		if ok && wakeup < game.nextTickTime {
+			clock.AdvanceTo(wakeup)
+		} else {
+			clock.AdvanceTo(game.nextTickTime)
+			game.runDueTicks()
+		}
+	}
+}
+
+// Run all ticks that are due according to the clock
+// The ticker may fire late or drop events when the main loop is busy, so the
+// number of ticks to run is derived from the time instead of counting ticker
+// events.  A small backlog is caught up on, a large one is skipped.
+func (game *Game) runDueTicks() {
+	now := game.clock.Now()
+	if now < game.nextTickTime {
+		return
+	}
+
+	due := (now-game.nextTickTime)/TickLength + 1
+	if due > maxTickBacklog {
+		log.Stderrf("Main loop is %d ticks behind, skipping %d ticks", due, due-1)
+		game.nextTickTime += (due - 1) * TickLength
+		due = 1
+	}
+
+	for ; due > 0; due-- {
+		start := time.Nanoseconds()
+		game.tick()
+		length := time.Nanoseconds() - start
+
+		game.avgTickLength = (game.avgTickLength*7 + length) / 8
+		if length > TickLength {
+			log.Stderrf("Tick %d took %.1f ms (average %.1f ms)", game.tickCount,
+				float64(length)/1e6, float64(game.avgTickLength)/1e6)
+		}
+
+		game.nextTickTime += TickLength
 	}
 }
 
@@ -117,19 +302,71 @@ func (game *Game) sendTimeUpdate() {
 	game.MulticastPacket(buf.Bytes(), nil)
 }
 
+func (game *Game) sendKeepAlive() {
+	buf := &bytes.Buffer{}
+	WriteKeepAlive(buf)
+	game.MulticastPacket(buf.Bytes(), nil)
+}
+
+func (game *Game) saveLevel() {
+	game.level.Time = game.time
+	err := game.level.Save()
+	if err != nil {
+		log.Stderr("saveLevel: ", err.String())
+	}
+}
+
+// Run every entity's behaviour for one tick, then move it between chunks if
+// it crossed a chunk boundary
+func (game *Game) tickEntities() {
+	// Mobs and items stored in chunks come to life after their chunk is loaded
+	for _, object := range game.chunkManager.TakePendingEntities() {
+		game.AddEntity(object)
+	}
+
+	for _, object := range game.entityManager.Entities() {
+		entityID := object.GetEntity().EntityID
+
+		// An earlier entity may have removed this one during the tick
+		if game.entityManager.Get(entityID) != object {
+			continue
+		}
+		object.Tick(game)
+		if game.entityManager.Get(entityID) != object {
+			continue
+		}
+		game.chunkManager.UpdateEntity(object)
+	}
+}
+
 func (game *Game) tick() {
-	game.time += 20
-	game.sendTimeUpdate()
+	game.time++
+	game.tickCount++
+	game.tickEntities()
+	game.scheduler.Run(game, game.tickCount)
 }
 
-func NewGame(chunkManager *ChunkManager) (game *Game) {
+func NewGame(chunkManager *ChunkManager, level *Level, clock Clock) (game *Game) {
 	game = &Game{
 		chunkManager: chunkManager,
+		level:        level,
 		mainQueue:    make(chan func(*Game), 256),
 		players:      make(map[EntityID]*Player),
+		time:         level.Time,
+		clock:        clock,
+	}
+
+	if *timeUpdateInterval > 0 {
+		game.ScheduleRepeating(int64(*timeUpdateInterval), func(game *Game) { game.sendTimeUpdate() })
+	}
+	// Simulations must not change the world on disk
+	if _, virtual := clock.(*VirtualClock); !virtual {
+		game.ScheduleRepeating(levelSaveInterval, func(game *Game) { game.saveLevel() })
+		game.ScheduleRepeating(chunkSaveInterval, func(game *Game) { game.chunkManager.SaveChunks() })
 	}
+	game.ScheduleRepeating(keepAliveInterval, func(game *Game) { game.sendKeepAlive() })
+	game.ScheduleRepeating(1, func(game *Game) { game.entityTracker.Update(game) })
 
 	go game.mainLoop()
-	go game.timer()
 	return
 }
@@ -0,0 +1,354 @@
+// Regression checks against golden transcripts
+//
+// A golden case is a directory of client recordings along with a transcript of
+// every packet the server sent to each of them while they were replayed
+// together.  Each case is replayed into its own game on a virtual clock, so the
+// transcript is the same on every run unless the server's behaviour changes.
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"log"
+	"flag"
+	"path"
+	"sort"
+	"sync"
+	"bytes"
+	"strings"
+	"io/ioutil"
+	"io"
+	"hash/crc32"
+	"compress/gzip"
+	"compress/zlib"
+	"proto"
+)
+
+var golden = flag.String("golden", "", "directory of golden cases to check, then exit")
+var goldenUpdate = flag.Bool("golden-update", false, "write the transcripts of golden cases instead of checking them")
+
+// The transcript in each case directory
+const goldenFile = "transcript.golden"
+
+// Lines of context shown around each difference
+const diffContext = 3
+
+// A replayed connection that keeps a transcript of the packets sent to it
+type goldenConn struct {
+	*replayConn
+	lock       sync.Mutex
+	received   *proto.PacketBuffer
+	transcript *bytes.Buffer
+	err        os.Error // the first undecodable packet
+}
+
+func newGoldenConn(path string, clock Clock) (*goldenConn, os.Error) {
+	replay, err := newReplayConn(path, clock, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goldenConn{
+		replayConn: replay,
+		received:   proto.NewPacketBuffer(replay.packets.Codec(), false),
+		transcript: &bytes.Buffer{},
+	}, nil
+}
+
+// The checksum of compressed data once it is uncompressed, which unlike the
+// compressed data does not depend on the compression implementation
+func uncompressedChecksum(reader io.ReadCloser, err os.Error) string {
+	if err != nil {
+		return "invalid"
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return "invalid"
+	}
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+}
+
+// Compressed data in map chunks and complex entities is summarized by a
+// checksum
+func describeGolden(packet proto.Packet) string {
+	switch p := packet.(type) {
+	case *proto.MapChunkPacket:
+		checksum := uncompressedChecksum(zlib.NewReader(bytes.NewBuffer(p.CompressedData)))
+		return fmt.Sprintf("{X:%d Y:%d Z:%d SizeX:%d SizeY:%d SizeZ:%d Data:<crc32 %s>}",
+			p.X, p.Y, p.Z, p.SizeX, p.SizeY, p.SizeZ, checksum)
+	case *proto.ComplexEntityPacket:
+		checksum := uncompressedChecksum(gzip.NewReader(bytes.NewBuffer(p.Payload)))
+		return fmt.Sprintf("{X:%d Y:%d Z:%d Payload:<crc32 %s>}", p.X, p.Y, p.Z, checksum)
+	}
+	return fmt.Sprintf("%+v", packet)
+}
+
+func (conn *goldenConn) Write(b []byte) (n int, err os.Error) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	// The server answers the login request in the client's protocol version
+	conn.received.SetCodec(conn.packets.Codec())
+	conn.received.Write(b)
+	for conn.err == nil {
+		packet, _, err := conn.received.Next()
+		if err != nil {
+			conn.err = err
+			break
+		}
+		if packet == nil {
+			break
+		}
+
+		fmt.Fprintf(conn.transcript, "%8.3f %#02x %s %s\n", float64(conn.clock.Now())/1e9,
+			packet.ID(), proto.PacketName(packet), describeGolden(packet))
+	}
+	return len(b), nil
+}
+
+// List the files in a directory with the given suffix, in name order
+func readDirSuffix(dir string, suffix string) (names []string, err os.Error) {
+	f, err := os.Open(dir, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	all, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	names = make([]string, 0, len(all))
+	for _, name := range all {
+		if strings.HasSuffix(name, suffix) {
+			names = names[0 : len(names)+1]
+			names[len(names)-1] = name
+		}
+	}
+	sort.SortStrings(names)
+	return
+}
+
+// Golden cases are played in a flat world of stone, so that their transcripts
+// do not depend on any files outside the case directories.  Chunk (0, 1),
+// next to the spawn chunk, is furnished, so that every case streams tile
+// entities and entities.
+func newGoldenWorld() (*ChunkManager, *Level) {
+	store := NewFlatWorld(64, BlockStone)
+	store.Put(NewFurnishedChunk(0, 1, 64, BlockStone))
+	return NewChunkManager(store), NewLevel("golden", 8, 64, 8, 0)
+}
+
+// Replay a case's recordings together in a new game and return the
+// transcripts of all connections, one after another
+func runGoldenCase(caseDir string) (transcript []byte, err os.Error) {
+	recordings, err := readDirSuffix(caseDir, recordingSuffix)
+	if err != nil {
+		return
+	}
+	if len(recordings) == 0 {
+		return nil, os.NewError("no recordings")
+	}
+
+	clock := NewVirtualClock()
+	chunkManager, level := newGoldenWorld()
+	game := NewGame(chunkManager, level, clock)
+
+	conns := make([]*goldenConn, len(recordings))
+	for i, name := range recordings {
+		conns[i], err = newGoldenConn(path.Join(caseDir, name), clock)
+		if err != nil {
+			for _, conn := range conns[0:i] {
+				conn.Close()
+			}
+			return // the clock is still held, so the game never starts
+		}
+
+		// Recordings that start at the same time log in in name order
+		conns[i].lastTimestamp += int64(i)
+	}
+
+	done := make(chan bool)
+	for _, conn := range conns {
+		clock.Join()
+		go func(conn *goldenConn) {
+			game.Login(conn)
+			<-conn.closed
+			clock.Leave()
+			done <- true
+		}(conn)
+	}
+	clock.Leave()
+	for _ = range conns {
+		<-done
+	}
+
+	// Stop the game from ticking on by itself
+	clock.Join()
+
+	buf := &bytes.Buffer{}
+	for i, conn := range conns {
+		conn.lock.Lock()
+		if conn.err != nil {
+			err = os.NewError(recordings[i] + ": " + conn.err.String())
+		}
+		fmt.Fprintf(buf, "== %s\n", recordings[i])
+		buf.Write(conn.transcript.Bytes())
+		conn.lock.Unlock()
+	}
+	return buf.Bytes(), err
+}
+
+func splitLines(data []byte) []string {
+	s := string(data)
+	if strings.HasSuffix(s, "\n") {
+		s = s[:len(s)-1]
+	}
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n", -1)
+}
+
+// Show how two transcripts differ line by line
+// Lines only in want are prefixed with -, lines only in got with +, and each
+// run of changes is shown with a few unchanged lines around it.
+func diffLines(want, got []string) string {
+	// common[i][j] is the length of the longest common subsequence of
+	// want[i:] and got[j:]
+	common := make([][]int, len(want)+1)
+	for i := range common {
+		common[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			switch {
+			case want[i] == got[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	// Walk the table to get each output line with its prefix
+	lines := make([]string, 0, len(want)+len(got))
+	changed := make([]bool, 0, len(want)+len(got))
+	add := func(prefix string, line string, change bool) {
+		n := len(lines)
+		lines = lines[0 : n+1]
+		changed = changed[0 : n+1]
+		lines[n] = prefix + line
+		changed[n] = change
+	}
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			add("  ", want[i], false)
+			i++
+			j++
+		case j == len(got) || (i < len(want) && common[i+1][j] >= common[i][j+1]):
+			add("- ", want[i], true)
+			i++
+		default:
+			add("+ ", got[j], true)
+			j++
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	lastShown := -1
+	for n := range lines {
+		near := false
+		for k := n - diffContext; k <= n+diffContext; k++ {
+			if k >= 0 && k < len(changed) && changed[k] {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+
+		if n != lastShown+1 {
+			buf.WriteString("...\n")
+		}
+		buf.WriteString(lines[n] + "\n")
+		lastShown = n
+	}
+	if lastShown >= 0 && lastShown != len(lines)-1 {
+		buf.WriteString("...\n")
+	}
+	return buf.String()
+}
+
+// Check or update every golden case in the directory named by --golden
+// Returns false if any case failed.
+func RunGoldenCases() bool {
+	dir, err := os.Open(*golden, os.O_RDONLY, 0)
+	if err != nil {
+		log.Exit(err.String())
+	}
+	infos, err := dir.Readdir(-1)
+	dir.Close()
+	if err != nil {
+		log.Exit(err.String())
+	}
+
+	cases := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDirectory() {
+			cases = cases[0 : len(cases)+1]
+			cases[len(cases)-1] = info.Name
+		}
+	}
+	sort.SortStrings(cases)
+	if len(cases) == 0 {
+		log.Stderr("No golden cases in ", *golden)
+		return false
+	}
+
+	ok := true
+	for _, name := range cases {
+		caseDir := path.Join(*golden, name)
+		goldenPath := path.Join(caseDir, goldenFile)
+
+		transcript, err := runGoldenCase(caseDir)
+		if err != nil {
+			log.Stderrf("%s: FAILED: %s", name, err.String())
+			ok = false
+			continue
+		}
+
+		if *goldenUpdate {
+			err = ioutil.WriteFile(goldenPath, transcript, 0644)
+			if err != nil {
+				log.Stderrf("%s: FAILED: %s", name, err.String())
+				ok = false
+				continue
+			}
+			log.Stderrf("%s: updated", name)
+			continue
+		}
+
+		want, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			log.Stderrf("%s: FAILED: %s", name, err.String())
+			ok = false
+			continue
+		}
+		if !bytes.Equal(want, transcript) {
+			log.Stderrf("%s: FAILED: transcript differs from %s:\n%s", name, goldenPath,
+				diffLines(splitLines(want), splitLines(transcript)))
+			ok = false
+			continue
+		}
+		log.Stderrf("%s: ok", name)
+	}
+	return ok
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+// Every case under golden still produces its transcript
+func TestGoldenCases(t *testing.T) {
+	*golden = "golden"
+	*goldenUpdate = false
+	if !RunGoldenCases() {
+		t.Error("golden cases failed, see the log for the differences")
+	}
+}
+
+// Differences are shown with their context, and far apart ones separately
+func TestDiffLines(t *testing.T) {
+	want := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	got := []string{"a", "B", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
+
+	expected := "  a\n" +
+		"- b\n" +
+		"+ B\n" +
+		"  c\n" +
+		"  d\n" +
+		"  e\n" +
+		"...\n" +
+		"  h\n" +
+		"  i\n" +
+		"  j\n" +
+		"+ k\n"
+	if diff := diffLines(want, got); diff != expected {
+		t.Errorf("diff is\n%s\nexpected\n%s", diff, expected)
+	}
+
+	if diff := diffLines(want, want); diff != "" {
+		t.Errorf("diff of equal lines is\n%s", diff)
+	}
+}
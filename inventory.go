@@ -0,0 +1,91 @@
+// What players carry
+
+package main
+
+import (
+	"proto"
+)
+
+const (
+	// Slots in a player's main inventory, the hotbar included
+	inventorySize = 36
+
+	// Items of a type stack up to this many per slot
+	maxStackSize = 64
+)
+
+// The main inventory of a player
+// The client decides what happens to items while they are in its inventory,
+// this only keeps track of what the player picked up and dropped.
+type Inventory struct {
+	slots [inventorySize]proto.ItemSlot
+}
+
+func NewInventory() *Inventory {
+	inventory := &Inventory{}
+	for i := range inventory.slots {
+		inventory.slots[i].ID = -1
+	}
+	return inventory
+}
+
+// Put items in the inventory, filling stacks of the same item before empty
+// slots
+// Returns how many of the items fit.
+func (inventory *Inventory) Add(itemID int16, count byte) (added byte) {
+	for pass := 0; pass < 2 && added < count; pass++ {
+		for i := range inventory.slots {
+			slot := &inventory.slots[i]
+			switch {
+			case pass == 0 && slot.ID == itemID:
+			case pass == 1 && slot.ID == -1:
+				slot.ID = itemID
+				slot.Count = 0
+				slot.Damage = 0
+			default:
+				continue
+			}
+
+			n := count - added
+			if space := maxStackSize - slot.Count; n > space {
+				n = space
+			}
+			slot.Count += n
+			added += n
+			if added == count {
+				break
+			}
+		}
+	}
+	return
+}
+
+// Take items out of the inventory
+// Returns how many of the items were there to take.
+func (inventory *Inventory) Remove(itemID int16, count byte) (removed byte) {
+	for i := range inventory.slots {
+		slot := &inventory.slots[i]
+		if slot.ID != itemID {
+			continue
+		}
+
+		n := count - removed
+		if n > slot.Count {
+			n = slot.Count
+		}
+		slot.Count -= n
+		removed += n
+		if slot.Count == 0 {
+			slot.ID = -1
+		}
+		if removed == count {
+			break
+		}
+	}
+	return
+}
+
+// The slots as sent in inventory packets
+func (inventory *Inventory) Slots() []proto.ItemSlot {
+	return inventory.slots[:]
+}
@@ -0,0 +1,263 @@
+// Items lying in the world, waiting to be picked up
+
+package main
+
+import (
+	"io"
+	"os"
+	"math"
+	"bytes"
+	"nbt"
+)
+
+const (
+	// Items fall faster by this much every tick, in blocks per tick
+	itemGravity = 0.04
+
+	// Items never fall more than a block per tick, so that they cannot
+	// pass through the block they should land on
+	itemMaxFallSpeed = 1
+
+	// Fractions of their velocity that items keep each tick, in the air and
+	// when sliding along the ground
+	itemDrag           = 0.98
+	itemGroundFriction = 0.6
+
+	// Below this speed, in blocks per tick, items stop sliding
+	itemMinSpeed = 0.001
+
+	// Ticks after which an item nobody picked up disappears
+	itemDespawnTicks = 5 * 60 * TicksPerSecond
+
+	// Ticks before an item can be picked up.  Thrown items wait longer so
+	// that they are not picked up right away by the player who threw them.
+	itemPickupDelay       = TicksPerSecond / 2
+	thrownItemPickupDelay = 2 * TicksPerSecond
+
+	// How close a player must come to pick up an item, and how close stacks
+	// of the same item must come to merge, in blocks
+	itemPickupDistance = 1
+	itemMergeDistance  = 0.5
+
+	// Size of an item's bounding box, in blocks
+	itemSize = 0.25
+
+	// Damage an item can take before it is destroyed, as saved in chunk
+	// files
+	itemHealth = 5
+)
+
+// A stack of items dropped in the world
+type ItemEntity struct {
+	Entity
+	itemID      int16
+	count       byte
+	age         int64 // ticks since the item was dropped
+	pickupDelay int64 // ticks before the item can be picked up
+	onGround    bool
+}
+
+func NewItemEntity(itemID int16, count byte, position *XYZ, velocity *XYZ) *ItemEntity {
+	item := &ItemEntity{
+		itemID:      itemID,
+		count:       count,
+		pickupDelay: itemPickupDelay,
+	}
+	item.position = *position
+	item.velocity = *velocity
+	item.width = itemSize
+	item.height = itemSize
+	return item
+}
+
+// The item left behind by a broken block, if any
+func blockDrop(blockType byte) (itemID int16, ok bool) {
+	switch blockType {
+	case BlockAir, BlockBedrock, BlockWater, BlockStationaryWater, BlockLava, BlockStationaryLava:
+		return 0, false
+	case BlockStone:
+		return BlockCobblestone, true
+	case BlockGrass:
+		return BlockDirt, true
+	}
+	return int16(blockType), true
+}
+
+func (item *ItemEntity) WriteSpawn(writer io.Writer) os.Error {
+	x, y, z := packPosition(&item.position)
+	vx, vy, vz := packVelocity(&item.velocity)
+	return WritePickupSpawn(writer, item.EntityID, item.itemID, item.count, x, y, z, vx, vy, vz)
+}
+
+func (item *ItemEntity) SaveNBT() *nbt.Compound {
+	data := item.saveNBT("Item")
+
+	// The stack keeps the damage value it was loaded with
+	stack, ok := data.Lookup("Item").(*nbt.Compound)
+	if !ok {
+		stack = nbt.NewCompound()
+		stack.Set("Damage", &nbt.Short{0})
+		data.Set("Item", stack)
+	}
+	stack.Set("id", &nbt.Short{item.itemID})
+	stack.Set("Count", &nbt.Byte{int8(item.count)})
+
+	data.Set("Age", &nbt.Short{int16(item.age)})
+	if _, ok := data.Lookup("Health").(*nbt.Short); !ok {
+		data.Set("Health", &nbt.Short{itemHealth})
+	}
+	return data
+}
+
+func (item *ItemEntity) Tick(game *Game) {
+	item.age++
+	if item.age >= itemDespawnTicks || item.position.y < 0 {
+		game.RemoveEntity(item)
+		return
+	}
+
+	item.move(game.chunkManager)
+	item.mergeNearby(game)
+	item.collect(game)
+}
+
+// Items are treated as points when colliding with blocks
+// Chunks that are not loaded count as solid, so that items stay within the
+// loaded area instead of loading more of the world.
+func solidAt(mgr *ChunkManager, x float64, y float64, z float64) bool {
+	blockType, ok := mgr.LoadedBlock(int32(math.Floor(x)), int(math.Floor(y)), int32(math.Floor(z)))
+	return !ok || blockType != BlockAir
+}
+
+// Fall until landing on a block, then slide to a stop
+func (item *ItemEntity) move(mgr *ChunkManager) {
+	position := &item.position
+	velocity := &item.velocity
+
+	velocity.y -= itemGravity
+	if velocity.y < -itemMaxFallSpeed {
+		velocity.y = -itemMaxFallSpeed
+	}
+
+	// Blocks stop horizontal movement dead
+	if solidAt(mgr, position.x+velocity.x, position.y, position.z) {
+		velocity.x = 0
+	}
+	position.x += velocity.x
+	if solidAt(mgr, position.x, position.y, position.z+velocity.z) {
+		velocity.z = 0
+	}
+	position.z += velocity.z
+
+	y := position.y + velocity.y
+	item.onGround = false
+	switch {
+	case velocity.y < 0 && solidAt(mgr, position.x, y, position.z):
+		// Land on top of the block
+		position.y = math.Floor(y) + 1
+		velocity.y = 0
+		item.onGround = true
+	case velocity.y > 0 && solidAt(mgr, position.x, y+item.height, position.z):
+		velocity.y = 0
+	default:
+		position.y = y
+	}
+
+	velocity.x *= itemDrag
+	velocity.y *= itemDrag
+	velocity.z *= itemDrag
+	if item.onGround {
+		velocity.x *= itemGroundFriction
+		velocity.z *= itemGroundFriction
+	}
+	if math.Fabs(velocity.x) < itemMinSpeed {
+		velocity.x = 0
+	}
+	if math.Fabs(velocity.z) < itemMinSpeed {
+		velocity.z = 0
+	}
+}
+
+// Absorb close by stacks of the same item
+// Items in the chunks next to the item's chunk are considered too, since the
+// item may lie on the border, as long as those chunks are loaded.
+func (item *ItemEntity) mergeNearby(game *Game) {
+	nearby := make(map[EntityID]EntityObject)
+	for x := item.chunkX - 1; x <= item.chunkX+1; x++ {
+		for z := item.chunkZ - 1; z <= item.chunkZ+1; z++ {
+			chunk, ok := game.chunkManager.Loaded(x, z)
+			if !ok {
+				continue
+			}
+			for id, object := range chunk.entities {
+				nearby[id] = object
+			}
+		}
+	}
+
+	merged := false
+	for _, object := range sortedEntities(nearby) {
+		other, ok := object.(*ItemEntity)
+		if !ok || other == item || other.itemID != item.itemID ||
+			int(item.count)+int(other.count) > maxStackSize ||
+			!item.Near(&other.Entity, itemMergeDistance) {
+			continue
+		}
+
+		item.count += other.count
+		if other.age < item.age {
+			item.age = other.age
+		}
+		game.RemoveEntity(other)
+		merged = true
+	}
+
+	if merged {
+		game.entityTracker.Respawn(item)
+	}
+}
+
+// Go into the inventory of a player close by
+// Whatever does not fit stays on the ground.
+func (item *ItemEntity) collect(game *Game) {
+	if item.age < item.pickupDelay {
+		return
+	}
+
+	chunk, ok := game.chunkManager.Loaded(item.chunkX, item.chunkZ)
+	if !ok {
+		return
+	}
+	nearby := make(map[EntityID]EntityObject)
+	for id, player := range chunk.players {
+		nearby[id] = player
+	}
+
+	for _, object := range sortedEntities(nearby) {
+		player := object.(*Player)
+		if !item.Near(&player.Entity, itemPickupDistance) {
+			continue
+		}
+		added := player.inventory.Add(item.itemID, item.count)
+		if added == 0 {
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		WriteCollectItem(buf, item.EntityID, player.EntityID)
+		for _, viewer := range chunk.players {
+			viewer.TransmitPacket(buf.Bytes())
+		}
+
+		buf = &bytes.Buffer{}
+		WriteAddToInventory(buf, item.itemID, added, 0)
+		player.TransmitPacket(buf.Bytes())
+
+		item.count -= added
+		if item.count == 0 {
+			game.RemoveEntity(item)
+			return
+		}
+		game.entityTracker.Respawn(item)
+	}
+}
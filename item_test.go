@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+// Items stop at the edge of the loaded area instead of loading the chunks
+// past it
+func TestItemStaysInLoadedChunks(t *testing.T) {
+	mgr := NewChunkManager(NewFlatWorld(64, BlockStone))
+	mgr.Get(0, 0)
+
+	item := NewItemEntity(BlockCobblestone, 1, &XYZ{15.5, 64, 8.5}, &XYZ{0.5, 0, 0})
+	for i := 0; i < 20; i++ {
+		item.move(mgr)
+	}
+
+	if item.position.x >= 16 {
+		t.Errorf("item moved out of the loaded chunk to x=%.2f", item.position.x)
+	}
+	if item.position.y != 64 {
+		t.Errorf("item at y=%.2f, expected it to rest on the ground at y=64", item.position.y)
+	}
+	if _, ok := mgr.Loaded(1, 0); ok {
+		t.Error("moving item loaded chunk (1, 0)")
+	}
+}
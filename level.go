@@ -0,0 +1,131 @@
+// World metadata stored in level.dat
+
+package main
+
+import (
+	"os"
+	"path"
+	"time"
+	"nbt"
+)
+
+type Level struct {
+	path           string
+	data           *nbt.NamedTag
+	SpawnX         int32
+	SpawnY         int32
+	SpawnZ         int32
+	RandomSeed     int64
+	Time           int64
+	LastPlayed     int64
+	SizeOnDisk     int64
+	LevelName      string
+	PlayerPosition *XYZ // nil if level.dat holds no player
+}
+
+// Load world metadata from a world directory
+func LoadLevel(worldPath string) (level *Level, err os.Error) {
+	levelPath := path.Join(worldPath, "level.dat")
+	file, err := os.Open(levelPath, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+
+	data, err := nbt.Read(file)
+	file.Close()
+	if err != nil {
+		return
+	}
+
+	level = &Level{
+		path:       levelPath,
+		data:       data,
+		SpawnX:     lookupInt(data, "/Data/SpawnX"),
+		SpawnY:     lookupInt(data, "/Data/SpawnY"),
+		SpawnZ:     lookupInt(data, "/Data/SpawnZ"),
+		RandomSeed: lookupLong(data, "/Data/RandomSeed"),
+		Time:       lookupLong(data, "/Data/Time"),
+		LastPlayed: lookupLong(data, "/Data/LastPlayed"),
+		SizeOnDisk: lookupLong(data, "/Data/SizeOnDisk"),
+	}
+
+	// Alpha worlds have no name, use the directory name instead
+	_, level.LevelName = path.Split(path.Clean(worldPath))
+
+	if name, ok := data.Lookup("/Data/LevelName").(*nbt.String); ok {
+		level.LevelName = name.Value
+	}
+
+	if pos, ok := lookupXYZ(data, "/Data/Player/Pos"); ok {
+		level.PlayerPosition = &pos
+	}
+	return
+}
+
+// Create world metadata that is not backed by a file, for fixture worlds
+// Such a level is never saved.
+func NewLevel(name string, spawnX, spawnY, spawnZ int32, randomSeed int64) *Level {
+	root := nbt.NewCompound()
+	root.Set("Data", nbt.NewCompound())
+
+	return &Level{
+		data:       nbt.NewNamedTag("", root),
+		SpawnX:     spawnX,
+		SpawnY:     spawnY,
+		SpawnZ:     spawnZ,
+		RandomSeed: randomSeed,
+		LevelName:  name,
+	}
+}
+
+// The block coordinates where new players appear
+func (level *Level) SpawnPosition() XYZ {
+	return XYZ{float64(level.SpawnX), float64(level.SpawnY), float64(level.SpawnZ)}
+}
+
+// The position a newly connected player starts at
+func (level *Level) StartPosition() XYZ {
+	if level.PlayerPosition != nil {
+		return *level.PlayerPosition
+	}
+	return XYZ{float64(level.SpawnX) + 0.5, float64(level.SpawnY), float64(level.SpawnZ) + 0.5}
+}
+
+// Write metadata back to level.dat
+// Tags that are not modelled by Level, like the single player's inventory,
+// are preserved.  The file is replaced atomically so a crash while saving
+// cannot corrupt the world.  Levels made by NewLevel are not saved.
+func (level *Level) Save() (err os.Error) {
+	if level.path == "" {
+		return
+	}
+	level.LastPlayed = time.Seconds() * 1000
+
+	data, ok := level.data.Lookup("/Data").(*nbt.Compound)
+	if !ok {
+		return os.NewError("level.dat has no Data compound")
+	}
+	data.Set("SpawnX", &nbt.Int{level.SpawnX})
+	data.Set("SpawnY", &nbt.Int{level.SpawnY})
+	data.Set("SpawnZ", &nbt.Int{level.SpawnZ})
+	data.Set("RandomSeed", &nbt.Long{level.RandomSeed})
+	data.Set("Time", &nbt.Long{level.Time})
+	data.Set("LastPlayed", &nbt.Long{level.LastPlayed})
+	data.Set("SizeOnDisk", &nbt.Long{level.SizeOnDisk})
+	data.Set("LevelName", &nbt.String{level.LevelName})
+
+	tmpPath := level.path + ".tmp"
+	file, err := os.Open(tmpPath, os.O_CREAT|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	err = nbt.Write(file, level.data)
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+
+	return os.Rename(tmpPath, level.path)
+}
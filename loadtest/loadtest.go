@@ -0,0 +1,252 @@
+// Load test a server with headless bots
+//
+// usage: loadtest [flags]
+//
+// Each bot logs in, wanders around its starting position, chats and digs.
+// Login latency, packet rates and disconnects are reported periodically and
+// when the test ends.
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"log"
+	"rand"
+	"sync"
+	"time"
+	"bot"
+	"proto"
+)
+
+var server = flag.String("server", "localhost:25565", "address of the server to test")
+var numBots = flag.Int("bots", 10, "number of bots to connect")
+var namePrefix = flag.String("name", "bot", "prefix of bot usernames")
+var version = flag.Int("version", 0, "protocol version to speak (default newest)")
+var spawnInterval = flag.Int("spawn-interval", 100, "milliseconds between bot logins")
+var duration = flag.Int("duration", 60, "seconds to run the test for")
+var reportInterval = flag.Int("report-interval", 5, "seconds between progress reports")
+var wanderRadius = flag.Float64("radius", 16, "blocks bots wander from where they log in")
+
+// Results shared by all bots
+type results struct {
+	lock           sync.Mutex
+	bots           []*bot.Bot
+	logins         int
+	loginFailures  int
+	minLatency     int64
+	maxLatency     int64
+	totalLatency   int64
+	disconnects    int
+	disconnectedBy map[string]int
+}
+
+func newResults() *results {
+	return &results{
+		bots:           make([]*bot.Bot, 0, *numBots),
+		disconnectedBy: make(map[string]int),
+	}
+}
+
+func (r *results) addLogin(b *bot.Bot, latency int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.logins == 0 || latency < r.minLatency {
+		r.minLatency = latency
+	}
+	if latency > r.maxLatency {
+		r.maxLatency = latency
+	}
+	r.totalLatency += latency
+	r.logins++
+
+	n := len(r.bots)
+	r.bots = r.bots[0 : n+1]
+	r.bots[n] = b
+}
+
+func (r *results) addLoginFailure(err os.Error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.loginFailures++
+	r.disconnectedBy["login: "+err.String()]++
+}
+
+func (r *results) addDisconnect(err os.Error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.disconnects++
+	r.disconnectedBy[err.String()]++
+}
+
+// Sum the traffic of all bots
+func (r *results) totals() (total bot.Stats) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, b := range r.bots {
+		stats := b.Stats()
+		total.PacketsReceived += stats.PacketsReceived
+		total.PacketsSent += stats.PacketsSent
+		total.ChunksReceived += stats.ChunksReceived
+	}
+	return
+}
+
+func (r *results) report(elapsed int64, last bot.Stats, lastElapsed int64) bot.Stats {
+	total := r.totals()
+	seconds := float64(elapsed-lastElapsed) / 1e9
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	log.Stderrf("%ds: %d/%d bots connected, %.0f packets/s received, %.0f packets/s sent, %d chunks, %d disconnects",
+		elapsed/1e9, r.logins-r.disconnects, *numBots,
+		float64(total.PacketsReceived-last.PacketsReceived)/seconds,
+		float64(total.PacketsSent-last.PacketsSent)/seconds,
+		total.ChunksReceived, r.disconnects)
+	return total
+}
+
+func (r *results) summary(elapsed int64) {
+	total := r.totals()
+	seconds := float64(elapsed) / 1e9
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fmt.Printf("Logins:        %d succeeded, %d failed\n", r.logins, r.loginFailures)
+	if r.logins > 0 {
+		fmt.Printf("Login latency: min %dms, avg %dms, max %dms\n",
+			r.minLatency/1e6, r.totalLatency/int64(r.logins)/1e6, r.maxLatency/1e6)
+	}
+	fmt.Printf("Received:      %d packets (%.0f/s), %d chunks\n",
+		total.PacketsReceived, float64(total.PacketsReceived)/seconds, total.ChunksReceived)
+	fmt.Printf("Sent:          %d packets (%.0f/s)\n",
+		total.PacketsSent, float64(total.PacketsSent)/seconds)
+	fmt.Printf("Disconnects:   %d\n", r.disconnects)
+	for reason, count := range r.disconnectedBy {
+		fmt.Printf("  %5d  %s\n", count, reason)
+	}
+}
+
+// A script that wanders around the starting position forever
+func wanderScript(rng *rand.Rand) []bot.Action {
+	const steps = 16
+
+	script := make([]bot.Action, 0, 3*steps)
+	add := func(action bot.Action) {
+		n := len(script)
+		script = script[0 : n+1]
+		script[n] = action
+	}
+
+	var x, z float64
+	for i := 0; i < steps; i++ {
+		// Pick points within the radius and walk back to the start at the end
+		nx, nz := 0.0, 0.0
+		if i < steps-1 {
+			nx = (rng.Float64()*2 - 1) * *wanderRadius
+			nz = (rng.Float64()*2 - 1) * *wanderRadius
+		}
+		add(bot.WalkBy(nx-x, 0, nz-z))
+		x, z = nx, nz
+
+		switch rng.Intn(4) {
+		case 0:
+			add(bot.Say(fmt.Sprintf("step %d", i)))
+		case 1:
+			add(bot.DigBelow(500e6))
+		}
+		add(bot.Idle(int64(rng.Intn(2000)) * 1e6))
+	}
+	return script
+}
+
+func runBot(index int, r *results, stop chan bool) {
+	username := fmt.Sprintf("%s%d", *namePrefix, index)
+
+	start := time.Nanoseconds()
+	b, err := bot.Connect(*server, username, int32(*version))
+	if err != nil {
+		r.addLoginFailure(err)
+		return
+	}
+	r.addLogin(b, time.Nanoseconds()-start)
+
+	rng := rand.New(rand.NewSource(int64(index)))
+	scriptErr := make(chan os.Error, 1)
+	go func() {
+		for {
+			err := b.RunScript(wanderScript(rng))
+			if err != nil {
+				scriptErr <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-stop:
+		b.Quit("Load test finished")
+	case err := <-scriptErr:
+		// Counted as a disconnect, as the bot stops taking part
+		b.Quit("Script failed")
+		r.addDisconnect(err)
+	case <-waitChan(b):
+		r.addDisconnect(b.Err())
+	}
+}
+
+// Signal on a channel when a bot's connection ends
+func waitChan(b *bot.Bot) chan bool {
+	c := make(chan bool, 1)
+	go func() {
+		b.Wait()
+		c <- true
+	}()
+	return c
+}
+
+func main() {
+	flag.Parse()
+
+	if *version == 0 {
+		*version = int(proto.NewestProtocolVersion)
+	}
+
+	r := newResults()
+	stop := make(chan bool)
+	finished := make(chan bool)
+
+	start := time.Nanoseconds()
+	for i := 0; i < *numBots; i++ {
+		go func(index int) {
+			runBot(index, r, stop)
+			finished <- true
+		}(i)
+		time.Sleep(int64(*spawnInterval) * 1e6)
+	}
+
+	ticker := time.NewTicker(int64(*reportInterval) * 1e9)
+	end := start + int64(*duration)*1e9
+	var last bot.Stats
+	var lastElapsed int64
+	for time.Nanoseconds() < end {
+		<-ticker.C
+		elapsed := time.Nanoseconds() - start
+		last = r.report(elapsed, last, lastElapsed)
+		lastElapsed = elapsed
+	}
+	ticker.Stop()
+
+	close(stop)
+	for i := 0; i < *numBots; i++ {
+		<-finished
+	}
+	r.summary(time.Nanoseconds() - start)
+}
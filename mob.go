@@ -0,0 +1,88 @@
+// Mobs are the animals and monsters that roam the world
+
+package main
+
+import (
+	"io"
+	"os"
+	"nbt"
+)
+
+// Mob types, as sent in mob spawn packets
+const (
+	MobCreeper  = 50
+	MobSkeleton = 51
+	MobSpider   = 52
+	MobGiant    = 53
+	MobZombie   = 54
+	MobSlime    = 55
+	MobPig      = 90
+	MobSheep    = 91
+	MobCow      = 92
+	MobChicken  = 93
+)
+
+// Width and height of each type of mob, in blocks
+var mobSizes = map[byte][2]float64{
+	MobCreeper:  {0.6, 1.8},
+	MobSkeleton: {0.6, 1.8},
+	MobSpider:   {1.4, 0.9},
+	MobGiant:    {3.6, 10.8},
+	MobZombie:   {0.6, 1.8},
+	MobSlime:    {0.6, 0.6},
+	MobPig:      {0.9, 0.9},
+	MobSheep:    {0.9, 1.3},
+	MobCow:      {0.9, 1.3},
+	MobChicken:  {0.3, 0.4},
+}
+
+// Names of mob types, as used in chunk files
+var mobNames = map[byte]string{
+	MobCreeper:  "Creeper",
+	MobSkeleton: "Skeleton",
+	MobSpider:   "Spider",
+	MobGiant:    "Giant",
+	MobZombie:   "Zombie",
+	MobSlime:    "Slime",
+	MobPig:      "Pig",
+	MobSheep:    "Sheep",
+	MobCow:      "Cow",
+	MobChicken:  "Chicken",
+}
+
+func mobTypeByName(name string) (mobType byte, ok bool) {
+	for mobType, mobName := range mobNames {
+		if mobName == name {
+			return mobType, true
+		}
+	}
+	return
+}
+
+type Mob struct {
+	Entity
+	mobType byte
+}
+
+func NewMob(mobType byte, position *XYZ) *Mob {
+	mob := &Mob{mobType: mobType}
+	mob.position = *position
+	if size, ok := mobSizes[mobType]; ok {
+		mob.width, mob.height = size[0], size[1]
+	}
+	return mob
+}
+
+// Mobs stand still until they have some AI
+func (mob *Mob) Tick(game *Game) {
+}
+
+func (mob *Mob) WriteSpawn(writer io.Writer) os.Error {
+	x, y, z := packPosition(&mob.position)
+	return WriteMobSpawn(writer, mob.EntityID, mob.mobType, x, y, z,
+		packAngle(mob.orientation.rotation), packAngle(mob.orientation.pitch))
+}
+
+func (mob *Mob) SaveNBT() *nbt.Compound {
+	return mob.saveNBT(mobNames[mob.mobType])
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"io"
 	"fmt"
+	"sort"
 	"strings"
 	"compress/gzip"
 	"encoding/binary"
@@ -28,6 +29,7 @@ const (
 type Tag interface {
 	GetType() byte
 	Read(io.Reader) os.Error
+	Write(io.Writer) os.Error
 	Lookup(path string) Tag
 }
 
@@ -72,6 +74,10 @@ func (end *End) Read(io.Reader) os.Error {
 	return nil
 }
 
+func (end *End) Write(io.Writer) os.Error {
+	return nil
+}
+
 func (end *End) Lookup(path string) Tag {
 	return nil
 }
@@ -81,6 +87,10 @@ type NamedTag struct {
 	tag  Tag
 }
 
+func NewNamedTag(name string, tag Tag) *NamedTag {
+	return &NamedTag{name, tag}
+}
+
 func (n *NamedTag) GetType() byte {
 	return TagNamed | n.tag.GetType()
 }
@@ -111,6 +121,24 @@ func (n *NamedTag) Read(reader io.Reader) (err os.Error) {
 	return
 }
 
+func (n *NamedTag) Write(writer io.Writer) (err os.Error) {
+	tagType := n.tag.GetType()
+	err = binary.Write(writer, binary.BigEndian, &tagType)
+	if err != nil {
+		return
+	}
+
+	if tagType != TagEnd {
+		name := String{n.name}
+		err = name.Write(writer)
+		if err != nil {
+			return
+		}
+	}
+
+	return n.tag.Write(writer)
+}
+
 func (n *NamedTag) Lookup(path string) Tag {
 	components := strings.Split(path, "/", 2)
 	if components[0] != n.name {
@@ -140,6 +168,10 @@ func (b *Byte) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &b.Value)
 }
 
+func (b *Byte) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &b.Value)
+}
+
 type Short struct {
 	Value int16
 }
@@ -152,6 +184,10 @@ func (s *Short) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &s.Value)
 }
 
+func (s *Short) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &s.Value)
+}
+
 func (*Short) Lookup(path string) Tag {
 	return nil
 }
@@ -168,6 +204,10 @@ func (i *Int) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &i.Value)
 }
 
+func (i *Int) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &i.Value)
+}
+
 func (*Int) Lookup(path string) Tag {
 	return nil
 }
@@ -184,6 +224,10 @@ func (l *Long) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &l.Value)
 }
 
+func (l *Long) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &l.Value)
+}
+
 func (*Long) Lookup(path string) Tag {
 	return nil
 }
@@ -200,6 +244,10 @@ func (f *Float) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &f.Value)
 }
 
+func (f *Float) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &f.Value)
+}
+
 func (*Float) Lookup(path string) Tag {
 	return nil
 }
@@ -216,6 +264,10 @@ func (d *Double) Read(reader io.Reader) (err os.Error) {
 	return binary.Read(reader, binary.BigEndian, &d.Value)
 }
 
+func (d *Double) Write(writer io.Writer) (err os.Error) {
+	return binary.Write(writer, binary.BigEndian, &d.Value)
+}
+
 func (*Double) Lookup(path string) Tag {
 	return nil
 }
@@ -246,6 +298,18 @@ func (b *ByteArray) Read(reader io.Reader) (err os.Error) {
 	return
 }
 
+func (b *ByteArray) Write(writer io.Writer) (err os.Error) {
+	length := Int{int32(len(b.Value))}
+
+	err = length.Write(writer)
+	if err != nil {
+		return
+	}
+
+	_, err = writer.Write(b.Value)
+	return
+}
+
 func (*ByteArray) Lookup(path string) Tag {
 	return nil
 }
@@ -276,12 +340,30 @@ func (s *String) Read(reader io.Reader) (err os.Error) {
 	return
 }
 
+func (s *String) Write(writer io.Writer) (err os.Error) {
+	bs := []byte(s.Value)
+	length := Short{int16(len(bs))}
+
+	err = length.Write(writer)
+	if err != nil {
+		return
+	}
+
+	_, err = writer.Write(bs)
+	return
+}
+
 func (*String) Lookup(path string) Tag {
 	return nil
 }
 
 type List struct {
-	Value []Tag
+	tagType byte
+	Value   []Tag
+}
+
+func NewList(tagType byte, value []Tag) *List {
+	return &List{tagType, value}
 }
 
 func (*List) GetType() byte {
@@ -312,10 +394,37 @@ func (l *List) Read(reader io.Reader) (err os.Error) {
 		list[i] = tag
 	}
 
+	l.tagType = byte(tagType.Value)
 	l.Value = list
 	return
 }
 
+func (l *List) Write(writer io.Writer) (err os.Error) {
+	tagType := Byte{int8(l.tagType)}
+	if len(l.Value) > 0 {
+		tagType.Value = int8(l.Value[0].GetType())
+	}
+
+	err = tagType.Write(writer)
+	if err != nil {
+		return
+	}
+
+	length := Int{int32(len(l.Value))}
+	err = length.Write(writer)
+	if err != nil {
+		return
+	}
+
+	for _, tag := range l.Value {
+		err = tag.Write(writer)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (*List) Lookup(path string) Tag {
 	return nil
 }
@@ -324,6 +433,10 @@ type Compound struct {
 	tags map[string]*NamedTag
 }
 
+func NewCompound() *Compound {
+	return &Compound{make(map[string]*NamedTag)}
+}
+
 func (*Compound) GetType() byte {
 	return TagCompound
 }
@@ -348,6 +461,32 @@ func (c *Compound) Read(reader io.Reader) (err os.Error) {
 	return
 }
 
+// Tags are written in order of name, so that a compound is always written the
+// same way
+func (c *Compound) Write(writer io.Writer) (err os.Error) {
+	names := make([]string, 0, len(c.tags))
+	for name := range c.tags {
+		names = names[0 : len(names)+1]
+		names[len(names)-1] = name
+	}
+	sort.SortStrings(names)
+
+	for _, name := range names {
+		err = c.tags[name].Write(writer)
+		if err != nil {
+			return
+		}
+	}
+
+	end := &NamedTag{"", &End{}}
+	return end.Write(writer)
+}
+
+// Add or replace a child tag
+func (c *Compound) Set(name string, tag Tag) {
+	c.tags[name] = &NamedTag{name, tag}
+}
+
 func (c *Compound) Lookup(path string) (tag Tag) {
 	components := strings.Split(path, "/", 2)
 	tag, ok := c.tags[components[0]]
@@ -378,3 +517,20 @@ func Read(reader io.Reader) (compound *NamedTag, err os.Error) {
 	}
 	return
 }
+
+func Write(writer io.Writer, compound *NamedTag) (err os.Error) {
+	var gzipWriter *gzip.Compressor
+
+	gzipWriter, err = gzip.NewWriter(writer)
+	if err != nil {
+		return
+	}
+
+	err = compound.Write(gzipWriter)
+	if err != nil {
+		gzipWriter.Close()
+		return
+	}
+
+	return gzipWriter.Close()
+}
@@ -0,0 +1,116 @@
+// Reading and writing game state as NBT tags
+//
+// Lookups return the zero value when the tag is missing or has another type,
+// so that files written by other versions load as far as possible.
+
+package main
+
+import (
+	"nbt"
+)
+
+func lookupByte(data nbt.Tag, path string) int8 {
+	if tag, ok := data.Lookup(path).(*nbt.Byte); ok {
+		return tag.Value
+	}
+	return 0
+}
+
+func lookupShort(data nbt.Tag, path string) int16 {
+	if tag, ok := data.Lookup(path).(*nbt.Short); ok {
+		return tag.Value
+	}
+	return 0
+}
+
+func lookupInt(data nbt.Tag, path string) int32 {
+	if tag, ok := data.Lookup(path).(*nbt.Int); ok {
+		return tag.Value
+	}
+	return 0
+}
+
+func lookupLong(data nbt.Tag, path string) int64 {
+	if tag, ok := data.Lookup(path).(*nbt.Long); ok {
+		return tag.Value
+	}
+	return 0
+}
+
+func lookupString(data nbt.Tag, path string) string {
+	if tag, ok := data.Lookup(path).(*nbt.String); ok {
+		return tag.Value
+	}
+	return ""
+}
+
+// The compounds in a list, skipping any other tags
+func lookupCompounds(data nbt.Tag, path string) (compounds []*nbt.Compound) {
+	list, ok := data.Lookup(path).(*nbt.List)
+	if !ok {
+		return
+	}
+
+	compounds = make([]*nbt.Compound, 0, len(list.Value))
+	for _, tag := range list.Value {
+		if compound, ok := tag.(*nbt.Compound); ok {
+			compounds = compounds[0 : len(compounds)+1]
+			compounds[len(compounds)-1] = compound
+		}
+	}
+	return
+}
+
+// A position or velocity stored as a list of three doubles
+func lookupXYZ(data nbt.Tag, path string) (xyz XYZ, ok bool) {
+	list, ok := data.Lookup(path).(*nbt.List)
+	if !ok || len(list.Value) != 3 {
+		return xyz, false
+	}
+
+	x, okX := list.Value[0].(*nbt.Double)
+	y, okY := list.Value[1].(*nbt.Double)
+	z, okZ := list.Value[2].(*nbt.Double)
+	if !okX || !okY || !okZ {
+		return xyz, false
+	}
+	return XYZ{x.Value, y.Value, z.Value}, true
+}
+
+func newXYZList(xyz *XYZ) *nbt.List {
+	return nbt.NewList(nbt.TagDouble, []nbt.Tag{
+		&nbt.Double{xyz.x},
+		&nbt.Double{xyz.y},
+		&nbt.Double{xyz.z},
+	})
+}
+
+// An orientation stored as a list of two floats
+func lookupOrientation(data nbt.Tag, path string) (orientation Orientation, ok bool) {
+	list, ok := data.Lookup(path).(*nbt.List)
+	if !ok || len(list.Value) != 2 {
+		return orientation, false
+	}
+
+	rotation, okRotation := list.Value[0].(*nbt.Float)
+	pitch, okPitch := list.Value[1].(*nbt.Float)
+	if !okRotation || !okPitch {
+		return orientation, false
+	}
+	return Orientation{rotation.Value, pitch.Value}, true
+}
+
+func newOrientationList(orientation *Orientation) *nbt.List {
+	return nbt.NewList(nbt.TagFloat, []nbt.Tag{
+		&nbt.Float{orientation.rotation},
+		&nbt.Float{orientation.pitch},
+	})
+}
+
+func newCompoundList(compounds []*nbt.Compound) *nbt.List {
+	tags := make([]nbt.Tag, len(compounds))
+	for i, compound := range compounds {
+		tags[i] = compound
+	}
+	return nbt.NewList(nbt.TagCompound, tags)
+}
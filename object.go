@@ -0,0 +1,74 @@
+// Objects are the vehicles and projectiles in the world
+
+package main
+
+import (
+	"io"
+	"os"
+	"nbt"
+)
+
+// Object types, as sent in add object packets
+const (
+	ObjectBoat        = 1
+	ObjectMinecart    = 10
+	ObjectStorageCart = 11
+	ObjectPoweredCart = 12
+	ObjectArrow       = 60
+	ObjectSnowball    = 61
+)
+
+// Names of object types, as used in chunk files
+// The kinds of minecart share a name and are told apart by a type tag.
+var objectNames = map[byte]string{
+	ObjectBoat:        "Boat",
+	ObjectMinecart:    "Minecart",
+	ObjectStorageCart: "Minecart",
+	ObjectPoweredCart: "Minecart",
+	ObjectArrow:       "Arrow",
+	ObjectSnowball:    "Snowball",
+}
+
+func objectTypeByName(name string) (objectType byte, ok bool) {
+	for objectType, objectName := range objectNames {
+		if objectName == name {
+			return objectType, true
+		}
+	}
+	return
+}
+
+type ObjectEntity struct {
+	Entity
+	objectType byte
+}
+
+func NewObjectEntity(objectType byte, position *XYZ) *ObjectEntity {
+	object := &ObjectEntity{objectType: objectType}
+	object.position = *position
+	switch objectType {
+	case ObjectArrow, ObjectSnowball:
+		object.width, object.height = 0.25, 0.25
+	default:
+		object.width, object.height = 0.98, 0.7
+	}
+	return object
+}
+
+// Objects stay where they are until they have physics
+func (object *ObjectEntity) Tick(game *Game) {
+}
+
+func (object *ObjectEntity) WriteSpawn(writer io.Writer) os.Error {
+	x, y, z := packPosition(&object.position)
+	return WriteAddObject(writer, object.EntityID, object.objectType, x, y, z)
+}
+
+func (object *ObjectEntity) SaveNBT() *nbt.Compound {
+	data := object.saveNBT(objectNames[object.objectType])
+	switch object.objectType {
+	case ObjectMinecart, ObjectStorageCart, ObjectPoweredCart:
+		data.Set("Type", &nbt.Int{int32(object.objectType - ObjectMinecart)})
+	}
+	return data
+}
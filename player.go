@@ -5,38 +5,96 @@ import (
 	"io"
 	"log"
 	"net"
+	"fmt"
+	"flag"
 	"math"
+	"sync"
+	"time"
 	"bytes"
+	"proto"
 )
 
+const (
+	// Size of a player's bounding box, in blocks
+	playerWidth  = 0.6
+	playerHeight = 1.8
+
+	// How far from a player the blocks it breaks and the items it throws
+	// can be, in blocks
+	maxReach = 6
+)
+
+// Player digging statuses
+const (
+	digStarted = 0
+	digDigging = 1
+	digStopped = 2
+	digBroken  = 3
+)
+
+var maxTxBacklog = flag.Int("max-tx-backlog", 16384, "KiB of unsent data after which a slow client is kicked")
+
 type Player struct {
 	Entity
 	game        *Game
 	conn        net.Conn
+	codec       *proto.Codec
 	name        string
-	position    XYZ
-	orientation Orientation
 	currentItem int16
-	txQueue     chan []byte
+	inventory   *Inventory
+
+	// Outgoing data waiting for TransmitLoop, protected by txLock.  Packets
+	// are appended to txPending so TransmitLoop can send everything that
+	// accumulated with a single write.
+	txLock     sync.Mutex
+	txPending  *bytes.Buffer
+	txClosed   bool
+	txWake     chan bool
+	txOverflow bool // only accessed from the main loop
+
+	// Set once the player has been removed from the game.  Only accessed
+	// from the main loop.
+	disconnected bool
+
+	// Wall clock time of the last received packet, in nanoseconds.  Only
+	// accessed by ReceiveLoop.
+	lastPacketTime int64
 }
 
-func StartPlayer(game *Game, conn net.Conn, name string) {
+func StartPlayer(game *Game, conn net.Conn, codec *proto.Codec, name string, entityID EntityID) {
 	player := &Player{
-		game:        game,
-		conn:        conn,
-		name:        name,
-		position:    StartPosition,
-		orientation: Orientation{0, 0},
-		txQueue:     make(chan []byte, 128),
+		game:      game,
+		conn:      conn,
+		codec:     codec,
+		name:      name,
+		inventory: NewInventory(),
+		txPending: &bytes.Buffer{},
+		txWake:    make(chan bool, 1),
+
+		lastPacketTime: time.Nanoseconds(),
 	}
+	player.EntityID = entityID
+	player.width = playerWidth
+	player.height = playerHeight
 
-	go player.ReceiveLoop()
+	// The player must be added before ReceiveLoop can enqueue a disconnect
 	go player.TransmitLoop()
-
 	game.Enqueue(func(game *Game) {
+		player.position = game.level.StartPosition()
 		game.AddPlayer(player)
 		player.postLogin()
 	})
+	go player.ReceiveLoop()
+}
+
+// Players move as their clients tell them to, not by themselves
+func (player *Player) Tick(game *Game) {
+}
+
+func (player *Player) WriteSpawn(writer io.Writer) os.Error {
+	x, y, z := packPosition(&player.position)
+	return WriteNamedEntitySpawn(writer, player.EntityID, player.name, x, y, z,
+		packAngle(player.orientation.rotation), packAngle(player.orientation.pitch), player.currentItem)
 }
 
 func (player *Player) PacketKeepAlive() {
@@ -66,11 +124,8 @@ func (player *Player) PacketPlayerPosition(position *XYZ, stance float64, flying
 			return
 		}
 
+		// The entity tracker tells other players about the move
 		player.position = *position
-
-		buf := &bytes.Buffer{}
-		WriteEntityTeleport(buf, player.EntityID, &player.position, &player.orientation)
-		game.MulticastPacket(buf.Bytes(), player)
 	})
 }
 
@@ -78,16 +133,47 @@ func (player *Player) PacketPlayerLook(orientation *Orientation, flying bool) {
 	player.game.Enqueue(func(game *Game) {
 		// TODO input validation
 		player.orientation = *orientation
-
-		buf := &bytes.Buffer{}
-		WriteEntityLook(buf, player.EntityID, orientation)
-		game.MulticastPacket(buf.Bytes(), player)
 	})
 }
 
 func (player *Player) PacketPlayerDigging(status byte, x int32, y byte, z int32, face byte) {
 	log.Stderrf("PacketPlayerDigging status=%d x=%d y=%d z=%d face=%d",
 		status, x, y, z, face)
+
+	if status != digBroken {
+		return
+	}
+	player.game.Enqueue(func(game *Game) { player.breakBlock(x, int(y), z) })
+}
+
+// True if the position is close enough for the player to reach
+func (player *Player) inReach(position *XYZ) bool {
+	var delta = XYZ{position.x - player.position.x,
+		position.y - player.position.y,
+		position.z - player.position.z}
+	return math.Sqrt(delta.x*delta.x+delta.y*delta.y+delta.z*delta.z) <= maxReach
+}
+
+// Take out a block and drop the item it leaves behind
+// This must be called from the main loop.
+func (player *Player) breakBlock(x int32, y int, z int32) {
+	game := player.game
+	center := XYZ{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}
+	blockType := game.chunkManager.Block(x, y, z)
+	if !player.inReach(&center) || blockType == BlockAir || blockType == BlockBedrock {
+		log.Stderrf("Discarding break of block (%d, %d, %d)", x, y, z)
+
+		// The client thinks the block is gone
+		buf := &bytes.Buffer{}
+		WriteBlockChange(buf, x, byte(y), z, blockType, 0)
+		player.TransmitPacket(buf.Bytes())
+		return
+	}
+
+	game.chunkManager.SetBlock(x, y, z, BlockAir)
+	if itemID, ok := blockDrop(blockType); ok {
+		game.AddEntity(NewItemEntity(itemID, 1, &center, &XYZ{0, 0.1, 0}))
+	}
 }
 
 func (player *Player) PacketPlayerBlockPlacement(blockItemID int16, x int32, y byte, z int32, direction byte) {
@@ -103,47 +189,160 @@ func (player *Player) PacketArmAnimation(forward bool) {
 	log.Stderrf("PacketArmAnimation forward=%v", forward)
 }
 
-func (player *Player) PacketDisconnect(reason string) {
-	log.Stderrf("PacketDisconnect reason=%s", reason)
+func (player *Player) PacketPickupSpawn(itemID int16, count byte, position *XYZ, velocity *XYZ) {
+	log.Stderrf("PacketPickupSpawn itemID=%d count=%d position=(%.2f, %.2f, %.2f)",
+		itemID, count, position.x, position.y, position.z)
+
 	player.game.Enqueue(func(game *Game) {
-		game.RemovePlayer(player)
-		close(player.txQueue)
-		player.conn.Close()
+		if count == 0 || count > maxStackSize || !player.inReach(position) {
+			log.Stderrf("Discarding thrown item %d", itemID)
+			return
+		}
+
+		// The client has already taken the items out of its inventory.  Only
+		// what it really had is thrown.
+		removed := player.inventory.Remove(itemID, count)
+		if removed == 0 {
+			log.Stderrf("Discarding thrown item %d the player does not have", itemID)
+			return
+		}
+
+		item := NewItemEntity(itemID, removed, position, velocity)
+		item.pickupDelay = thrownItemPickupDelay
+		game.AddEntity(item)
 	})
 }
 
+func (player *Player) PacketDisconnect(reason string) {
+	log.Stderrf("PacketDisconnect reason=%s", reason)
+	player.disconnect()
+}
+
+// Remove the player from the game and release the connection
+// This is the only teardown path for a player, whatever the cause.  It may be
+// called any number of times from any goroutine; only the first call has an
+// effect.
+func (player *Player) disconnect() {
+	player.game.Enqueue(func(game *Game) { player.remove() })
+}
+
+// Closing the transmit queue lets TransmitLoop flush pending packets and then
+// close the connection, which in turn terminates ReceiveLoop.  This must be
+// called from the main loop.
+func (player *Player) remove() {
+	if player.disconnected {
+		return
+	}
+	player.disconnected = true
+
+	player.game.RemovePlayer(player)
+
+	player.txLock.Lock()
+	player.txClosed = true
+	player.txLock.Unlock()
+	player.wakeTransmitLoop()
+}
+
+// Tell the client why it is being dropped and disconnect it
+// This must be called from the main loop.
+func (player *Player) Kick(reason string) {
+	if player.disconnected {
+		return
+	}
+	log.Stderrf("Kicking %s: %s", player.name, reason)
+
+	buf := &bytes.Buffer{}
+	WriteDisconnect(buf, reason)
+
+	// The kick bypasses the backlog limit, but a client that overflowed
+	// will not see earlier packets anyway so they are dropped
+	player.txLock.Lock()
+	if player.txOverflow {
+		player.txPending.Reset()
+	}
+	player.txPending.Write(buf.Bytes())
+	player.txLock.Unlock()
+
+	player.remove()
+}
+
 func (player *Player) ReceiveLoop() {
+	// Clients send packets several times a second, a silent connection is
+	// dead even if the socket is still open
+	player.conn.SetReadTimeout(int64(*playerTimeout) * 1e9)
+
 	for {
-		err := ReadPacket(player.conn, player)
+		packet, err := player.codec.ReadServerbound(player.conn)
+		if err == nil {
+			err = dispatchPacket(packet, player)
+		}
 		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				reason := fmt.Sprintf("Timed out after %.1f seconds of silence",
+					float64(time.Nanoseconds()-player.lastPacketTime)/1e9)
+				player.game.Enqueue(func(game *Game) { player.Kick(reason) })
+				return
+			}
+
 			if err != os.EOF {
 				log.Stderr("ReceiveLoop failed: ", err.String())
 			}
+			player.disconnect()
 			return
 		}
+
+		player.lastPacketTime = time.Nanoseconds()
+	}
+}
+
+// Sending counts as running on the game's clock, so that a virtual clock does
+// not move on while packets are still being written
+func (player *Player) wakeTransmitLoop() {
+	player.game.clock.Join()
+	select {
+	case player.txWake <- true:
+	default: // already pending
+		player.game.clock.Leave()
 	}
 }
 
 func (player *Player) TransmitLoop() {
+	player.conn.SetWriteTimeout(int64(*playerTimeout) * 1e9)
+
+	failed := false
 	for {
-		bs := <-player.txQueue
-		if bs == nil {
-			return // txQueue closed
-		}
+		<-player.txWake
 
-		_, err := player.conn.Write(bs)
-		if err != nil {
-			if err != os.EOF {
-				log.Stderr("TransmitLoop failed: ", err.String())
+		player.txLock.Lock()
+		pending := player.txPending
+		player.txPending = &bytes.Buffer{}
+		closing := player.txClosed
+		player.txLock.Unlock()
+
+		// Data is still taken off the queue after a failure so the
+		// backlog does not grow while the disconnect is pending
+		if !failed && pending.Len() > 0 {
+			_, err := player.conn.Write(pending.Bytes())
+			if err != nil {
+				if err != os.EOF {
+					log.Stderr("TransmitLoop failed: ", err.String())
+				}
+				failed = true
+				player.disconnect()
 			}
-			return
+		}
+		player.game.clock.Leave()
+
+		if closing {
+			break
 		}
 	}
+
+	player.conn.Close()
 }
 
 func (player *Player) sendChunks(writer io.Writer) {
-	playerX := ChunkCoord(player.position.x / ChunkSizeX)
-	playerZ := ChunkCoord(player.position.z / ChunkSizeZ)
+	playerX, playerZ := BlockToChunkCoords(player.position.x, player.position.z)
 
 	for z := playerZ - ChunkRadius; z <= playerZ+ChunkRadius; z++ {
 		for x := playerX - ChunkRadius; x <= playerX+ChunkRadius; x++ {
@@ -155,22 +354,51 @@ func (player *Player) sendChunks(writer io.Writer) {
 		for x := playerX - ChunkRadius; x <= playerX+ChunkRadius; x++ {
 			chunk := player.game.chunkManager.Get(x, z)
 			WriteMapChunk(writer, chunk)
+			for _, tileEntity := range chunk.TileEntities() {
+				WriteComplexEntity(writer, tileEntity)
+			}
 		}
 	}
 }
 
+// Queue a packet for sending without blocking
+// Clients that do not keep up with their packets are kicked once the unsent
+// backlog exceeds the limit, otherwise they would use up unbounded memory.
 func (player *Player) TransmitPacket(packet []byte) {
-	if packet == nil {
-		return // skip empty packets
+	if packet == nil || player.disconnected || player.txOverflow {
+		return // skip empty packets and departed players
+	}
+
+	player.txLock.Lock()
+	backlog := player.txPending.Len() + len(packet)
+	overflow := backlog > *maxTxBacklog*1024
+	if !overflow {
+		player.txPending.Write(packet)
 	}
-	player.txQueue <- packet
+	player.txLock.Unlock()
+
+	if overflow {
+		reason := fmt.Sprintf("Transmit backlog of %d bytes exceeds limit of %d KiB",
+			backlog, *maxTxBacklog)
+		player.txOverflow = true
+
+		// Enqueue from another goroutine, the main loop may be full.  The
+		// player is not removed right away because we may be called while
+		// iterating over players.
+		go player.game.Enqueue(func(game *Game) { player.Kick(reason) })
+		return
+	}
+
+	player.wakeTransmitLoop()
 }
 
 func (player *Player) postLogin() {
 	buf := &bytes.Buffer{}
-	WriteSpawnPosition(buf, &player.position)
+	spawnPosition := player.game.level.SpawnPosition()
+	WriteSpawnPosition(buf, &spawnPosition)
+	WriteTimeUpdate(buf, player.game.time)
 	player.sendChunks(buf)
-	WritePlayerInventory(buf)
+	WritePlayerInventory(buf, player.inventory.Slots())
 	WritePlayerPositionLook(buf, &player.position, &player.orientation,
 		0, false)
 	player.TransmitPacket(buf.Bytes())
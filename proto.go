@@ -7,38 +7,27 @@ import (
 	"bytes"
 	"encoding/binary"
 	"compress/zlib"
+	"nbt"
+	"proto"
 )
 
+// Packet encoding lives in the proto package.  This file translates between
+// packets and game types.  The Write* functions below encode packets whose
+// layout is the same in all protocol versions, so the result can be multicast
+// to any player.  Packets whose layout varies are written through the
+// player's Codec.
+
 const (
 	// Sometimes it is useful to convert block coordinates to pixels
 	PixelsPerBlock = 32
 
-	// Currently only this protocol version is supported
-	protocolVersion = 2
-
-	// Packet type IDs
-	packetIDKeepAlive            = 0x0
-	packetIDLogin                = 0x1
-	packetIDHandshake            = 0x2
-	packetIDChatMessage          = 0x3
-	packetIDTimeUpdate           = 0x4
-	packetIDPlayerInventory      = 0x5
-	packetIDSpawnPosition        = 0x6
-	packetIDFlying               = 0xa
-	packetIDPlayerPosition       = 0xb
-	packetIDPlayerLook           = 0xc
-	packetIDPlayerPositionLook   = 0xd
-	packetIDPlayerDigging        = 0xe
-	packetIDPlayerBlockPlacement = 0xf
-	packetIDHoldingChange        = 0x10
-	packetIDArmAnimation         = 0x12
-	packetIDNamedEntitySpawn     = 0x14
-	packetIDDestroyEntity        = 0x1d
-	packetIDEntityLook           = 0x20
-	packetIDEntityTeleport       = 0x22
-	packetIDPreChunk             = 0x32
-	packetIDMapChunk             = 0x33
-	packetIDDisconnect           = 0xff
+	// Velocities are sent in 1/128 blocks per tick
+	VelocityUnitsPerBlock = 128
+
+	// Except in entity velocity packets, which send 1/8000 blocks per tick
+	// up to a limit of 3.9 blocks per tick
+	EntityVelocityUnitsPerBlock = 8000
+	maxEntityVelocity           = 3.9 * EntityVelocityUnitsPerBlock
 
 	// Inventory types
 	inventoryTypeMain     = -1
@@ -57,41 +46,44 @@ type PacketHandler interface {
 	PacketPlayerBlockPlacement(blockItemID int16, x int32, y byte, z int32, direction byte)
 	PacketHoldingChange(blockItemID int16)
 	PacketArmAnimation(forward bool)
+	PacketPickupSpawn(itemID int16, count byte, position *XYZ, velocity *XYZ)
 	PacketDisconnect(reason string)
 }
 
-func boolToByte(b bool) byte {
-	if b {
-		return 1
-	}
-	return 0
-}
-
-func byteToBool(b byte) bool {
-	return b != 0
-}
-
-func ReadString(reader io.Reader) (s string, err os.Error) {
-	var length int16
-	err = binary.Read(reader, binary.BigEndian, &length)
-	if err != nil {
-		return
+// Pass a packet received from a client to the handler
+func dispatchPacket(packet proto.Packet, handler PacketHandler) (err os.Error) {
+	switch p := packet.(type) {
+	case *proto.KeepAlivePacket:
+		handler.PacketKeepAlive()
+	case *proto.ChatMessagePacket:
+		// TODO sanitize chat message
+		handler.PacketChatMessage(p.Message)
+	case *proto.FlyingPacket:
+		handler.PacketFlying(p.Flying)
+	case *proto.PlayerPositionPacket:
+		handler.PacketPlayerPosition(&XYZ{p.X, p.Y, p.Z}, p.Stance, p.Flying)
+	case *proto.PlayerLookPacket:
+		handler.PacketPlayerLook(&Orientation{p.Rotation, p.Pitch}, p.Flying)
+	case *proto.PlayerPositionLookPacket:
+		handler.PacketPlayerPosition(&XYZ{p.X, p.Y, p.Z}, p.Stance, p.Flying)
+		handler.PacketPlayerLook(&Orientation{p.Rotation, p.Pitch}, p.Flying)
+	case *proto.PlayerDiggingPacket:
+		handler.PacketPlayerDigging(p.Status, p.X, p.Y, p.Z, p.Face)
+	case *proto.PlayerBlockPlacementPacket:
+		handler.PacketPlayerBlockPlacement(p.BlockItemID, p.X, p.Y, p.Z, p.Direction)
+	case *proto.HoldingChangePacket:
+		handler.PacketHoldingChange(p.BlockItemID)
+	case *proto.ArmAnimationPacket:
+		handler.PacketArmAnimation(p.Forward)
+	case *proto.PickupSpawnPacket:
+		handler.PacketPickupSpawn(p.ItemID, p.Count,
+			&XYZ{float64(p.X) / PixelsPerBlock, float64(p.Y) / PixelsPerBlock, float64(p.Z) / PixelsPerBlock},
+			&XYZ{float64(p.VX) / VelocityUnitsPerBlock, float64(p.VY) / VelocityUnitsPerBlock, float64(p.VZ) / VelocityUnitsPerBlock})
+	case *proto.DisconnectPacket:
+		handler.PacketDisconnect(p.Reason)
+	default:
+		err = os.NewError(fmt.Sprintf("unhandled packet type %#x", packet.ID()))
 	}
-
-	bs := make([]byte, uint16(length))
-	_, err = io.ReadFull(reader, bs)
-	return string(bs), err
-}
-
-func WriteString(writer io.Writer, s string) (err os.Error) {
-	bs := []byte(s)
-
-	err = binary.Write(writer, binary.BigEndian, int16(len(bs)))
-	if err != nil {
-		return
-	}
-
-	_, err = writer.Write(bs)
 	return
 }
 
@@ -101,80 +93,58 @@ func ReadHandshake(reader io.Reader) (username string, err os.Error) {
 	if err != nil {
 		return
 	}
-	if packetID != packetIDHandshake {
-		panic(fmt.Sprintf("ReadHandshake: invalid packet ID %#x", packetID))
+	if packetID != proto.PacketIDHandshakeRequest {
+		err = &proto.UnexpectedPacketError{proto.PacketIDHandshakeRequest, packetID}
+		return
 	}
 
-	return ReadString(reader)
+	var packet proto.HandshakeRequestPacket
+	err = packet.Read(reader, proto.AnyVersion)
+	return packet.Username, err
 }
 
 func WriteHandshake(writer io.Writer, reply string) (err os.Error) {
-	err = binary.Write(writer, binary.BigEndian, byte(packetIDHandshake))
-	if err != nil {
-		return
-	}
-
-	return WriteString(writer, reply)
+	return (&proto.HandshakeReplyPacket{reply}).Write(writer, proto.AnyVersion)
 }
 
-func ReadLogin(reader io.Reader) (username, password string, err os.Error) {
-	var packet struct {
-		PacketID byte
-		Version  int32
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
+// Read the login packet and select the codec for the client's version
+// The login packet carries the protocol version, which determines the layout
+// of its remaining fields.
+func ReadLogin(reader io.Reader) (codec *proto.Codec, username, password string, err os.Error) {
+	var packetID byte
+	err = binary.Read(reader, binary.BigEndian, &packetID)
 	if err != nil {
 		return
 	}
-	if packet.PacketID != packetIDLogin {
-		panic(fmt.Sprintf("ReadLogin: invalid packet ID %#x", packet.PacketID))
-	}
-	if packet.Version != protocolVersion {
-		panic(fmt.Sprintf("ReadLogin: unsupported protocol version %#x", packet.Version))
+	if packetID != proto.PacketIDLoginRequest {
+		err = &proto.UnexpectedPacketError{proto.PacketIDLoginRequest, packetID}
+		return
 	}
 
-	username, err = ReadString(reader)
+	var packet proto.LoginRequestPacket
+	err = packet.Read(reader, proto.AnyVersion)
 	if err != nil {
 		return
 	}
 
-	password, err = ReadString(reader)
-	return
-}
-
-func WriteLogin(writer io.Writer) (err os.Error) {
-	_, err = writer.Write([]byte{packetIDLogin, 0, 0, 0, 0, 0, 0, 0, 0})
-	return err
+	codec, err = proto.LookupCodec(packet.ProtocolVersion)
+	return codec, packet.Username, packet.Password, err
 }
 
 func WriteSpawnPosition(writer io.Writer, position *XYZ) os.Error {
-	var packet = struct {
-		PacketID byte
-		X        int32
-		Y        int32
-		Z        int32
-	}{
-		packetIDSpawnPosition,
+	return (&proto.SpawnPositionPacket{
 		int32(position.x),
 		int32(position.y),
 		int32(position.z),
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+	}).Write(writer, proto.AnyVersion)
 }
 
 func WriteTimeUpdate(writer io.Writer, time int64) os.Error {
-	var packet = struct {
-		PacketID byte
-		Time     int64
-	}{
-		packetIDTimeUpdate,
-		time,
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+	return (&proto.TimeUpdatePacket{time}).Write(writer, proto.AnyVersion)
 }
 
-func WritePlayerInventory(writer io.Writer) (err os.Error) {
+// The armor and crafting slots are always sent empty
+func WritePlayerInventory(writer io.Writer, main []proto.ItemSlot) (err os.Error) {
 	type InventoryType struct {
 		inventoryType int32
 		count         int16
@@ -186,121 +156,119 @@ func WritePlayerInventory(writer io.Writer) (err os.Error) {
 	}
 
 	for _, inventory := range inventories {
-		var packet = struct {
-			PacketID      byte
-			InventoryType int32
-			Count         int16
-		}{
-			packetIDPlayerInventory,
-			inventory.inventoryType,
-			inventory.count,
+		items := make([]proto.ItemSlot, inventory.count)
+		for i := range items {
+			items[i].ID = -1
 		}
-		err = binary.Write(writer, binary.BigEndian, &packet)
-		if err != nil {
-			return
+		if inventory.inventoryType == inventoryTypeMain {
+			copy(items, main)
 		}
 
-		for i := int16(0); i < inventory.count; i++ {
-			err = binary.Write(writer, binary.BigEndian, int16(-1))
-			if err != nil {
-				return
-			}
+		err = (&proto.PlayerInventoryPacket{inventory.inventoryType, items}).Write(writer, proto.AnyVersion)
+		if err != nil {
+			return
 		}
 	}
 	return
 }
 
 func WritePlayerPosition(writer io.Writer, position *XYZ, stance float64, flying bool) os.Error {
-	var packet = struct {
-		PacketID byte
-		X        float64
-		Y        float64
-		Stance   float64
-		Z        float64
-		Flying   byte
-	}{
-		packetIDPlayerPosition,
+	return (&proto.PlayerPositionPacket{
 		position.x,
 		position.y,
 		stance,
 		position.z,
-		boolToByte(flying),
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+		flying,
+	}).Write(writer, proto.AnyVersion)
 }
 
 func WritePlayerPositionLook(writer io.Writer, position *XYZ, orientation *Orientation, stance float64, flying bool) os.Error {
-	var packet = struct {
-		PacketID byte
-		X        float64
-		Y        float64
-		Stance   float64
-		Z        float64
-		Rotation float32
-		Pitch    float32
-		Flying   byte
-	}{
-		packetIDPlayerPositionLook,
+	return (&proto.PlayerPositionLookPacket{
 		position.x,
 		position.y,
 		stance,
 		position.z,
 		orientation.rotation,
 		orientation.pitch,
-		boolToByte(flying),
+		flying,
+	}).Write(writer, proto.AnyVersion)
+}
+
+// Entity angles are sent as fractions of a turn, 256 to the full circle
+func packAngle(degrees float32) byte {
+	return byte(int32(degrees * 256 / 360))
+}
+
+// Entity positions are sent in pixels
+func packPosition(position *XYZ) (x, y, z int32) {
+	return int32(position.x * PixelsPerBlock), int32(position.y * PixelsPerBlock), int32(position.z * PixelsPerBlock)
+}
+
+// Velocities are clamped to what fits in the packets
+func packVelocity(velocity *XYZ) (vx, vy, vz int8) {
+	pack := func(v float64) int8 {
+		v *= VelocityUnitsPerBlock
+		switch {
+		case v > 127:
+			return 127
+		case v < -128:
+			return -128
+		}
+		return int8(v)
 	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+	return pack(velocity.x), pack(velocity.y), pack(velocity.z)
 }
 
-func WriteEntityLook(writer io.Writer, entityID EntityID, orientation *Orientation) os.Error {
-	var packet = struct {
-		PacketID byte
-		EntityID int32
-		Rotation byte
-		Pitch    byte
-	}{
-		packetIDEntityLook,
-		int32(entityID),
-		byte(orientation.rotation * 256 / 360),
-		byte(orientation.pitch * 64 / 90),
+func packEntityVelocity(velocity *XYZ) (vx, vy, vz int16) {
+	pack := func(v float64) int16 {
+		v *= EntityVelocityUnitsPerBlock
+		switch {
+		case v > maxEntityVelocity:
+			return maxEntityVelocity
+		case v < -maxEntityVelocity:
+			return -maxEntityVelocity
+		}
+		return int16(v)
 	}
-	return binary.Write(writer, binary.BigEndian, &packet)
-}
-
-func WriteEntityTeleport(writer io.Writer, entityID EntityID, position *XYZ, orientation *Orientation) os.Error {
-	var packet = struct {
-		PacketID byte
-		EntityID int32
-		X        int32
-		Y        int32
-		Z        int32
-		Rotation byte
-		Pitch    byte
-	}{
-		packetIDEntityTeleport,
+	return pack(velocity.x), pack(velocity.y), pack(velocity.z)
+}
+
+func WriteEntityVelocity(writer io.Writer, entityID EntityID, vx, vy, vz int16) os.Error {
+	return (&proto.EntityVelocityPacket{int32(entityID), vx, vy, vz}).Write(writer, proto.AnyVersion)
+}
+
+func WriteEntityRelativeMove(writer io.Writer, entityID EntityID, dx, dy, dz int8) os.Error {
+	return (&proto.EntityRelativeMovePacket{int32(entityID), dx, dy, dz}).Write(writer, proto.AnyVersion)
+}
+
+func WriteEntityLook(writer io.Writer, entityID EntityID, rotation, pitch byte) os.Error {
+	return (&proto.EntityLookPacket{int32(entityID), rotation, pitch}).Write(writer, proto.AnyVersion)
+}
+
+func WriteEntityLookAndRelativeMove(writer io.Writer, entityID EntityID, dx, dy, dz int8, rotation, pitch byte) os.Error {
+	return (&proto.EntityLookAndRelativeMovePacket{
 		int32(entityID),
-		int32(position.x * PixelsPerBlock),
-		int32(position.y * PixelsPerBlock),
-		int32(position.z * PixelsPerBlock),
-		byte(orientation.rotation * 256 / 360),
-		byte(orientation.pitch * 64 / 90),
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+		dx,
+		dy,
+		dz,
+		rotation,
+		pitch,
+	}).Write(writer, proto.AnyVersion)
+}
+
+func WriteEntityTeleport(writer io.Writer, entityID EntityID, x, y, z int32, rotation, pitch byte) os.Error {
+	return (&proto.EntityTeleportPacket{
+		int32(entityID),
+		x,
+		y,
+		z,
+		rotation,
+		pitch,
+	}).Write(writer, proto.AnyVersion)
 }
 
 func WritePreChunk(writer io.Writer, x ChunkCoord, z ChunkCoord, willSend bool) os.Error {
-	var packet = struct {
-		PacketID byte
-		X        int32
-		Z        int32
-		WillSend byte
-	}{
-		packetIDPreChunk,
-		int32(x),
-		int32(z),
-		boolToByte(willSend),
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
+	return (&proto.PreChunkPacket{int32(x), int32(z), willSend}).Write(writer, proto.AnyVersion)
 }
 
 func WriteMapChunk(writer io.Writer, chunk *Chunk) (err os.Error) {
@@ -315,293 +283,97 @@ func WriteMapChunk(writer io.Writer, chunk *Chunk) (err os.Error) {
 	compressed.Write(chunk.BlockLight)
 	compressed.Write(chunk.SkyLight)
 	compressed.Close()
-	bs := buf.Bytes()
-
-	var packet = struct {
-		PacketID         byte
-		X                int32
-		Y                int16
-		Z                int32
-		SizeX            byte
-		SizeY            byte
-		SizeZ            byte
-		CompressedLength int32
-	}{
-		packetIDMapChunk,
+
+	return (&proto.MapChunkPacket{
 		int32(chunk.X * ChunkSizeX),
 		0,
 		int32(chunk.Z * ChunkSizeZ),
 		ChunkSizeX - 1,
 		ChunkSizeY - 1,
 		ChunkSizeZ - 1,
-		int32(len(bs)),
-	}
-
-	err = binary.Write(writer, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-	err = binary.Write(writer, binary.BigEndian, bs)
-	return
+		buf.Bytes(),
+	}).Write(writer, proto.AnyVersion)
 }
 
-func WriteNamedEntitySpawn(writer io.Writer, entityID EntityID, name string, position *XYZ, orientation *Orientation, currentItem int16) (err os.Error) {
-	var packetStart = struct {
-		PacketID byte
-		EntityID int32
-	}{
-		packetIDNamedEntitySpawn,
-		int32(entityID),
-	}
-
-	err = binary.Write(writer, binary.BigEndian, &packetStart)
-	if err != nil {
-		return
-	}
-
-	err = WriteString(writer, name)
+// Tile entities are sent as gzipped NBT
+func WriteComplexEntity(writer io.Writer, tileEntity TileEntity) (err os.Error) {
+	buf := &bytes.Buffer{}
+	err = nbt.Write(buf, nbt.NewNamedTag("", tileEntity.SaveNBT()))
 	if err != nil {
 		return
 	}
 
-	var packetFinish = struct {
-		X           int32
-		Y           int32
-		Z           int32
-		Rotation    byte
-		Pitch       byte
-		CurrentItem int16
-	}{
-		int32(position.x * PixelsPerBlock),
-		int32(position.y * PixelsPerBlock),
-		int32(position.z * PixelsPerBlock),
-		byte(orientation.rotation),
-		byte(orientation.pitch),
-		currentItem,
-	}
-
-	err = binary.Write(writer, binary.BigEndian, &packetFinish)
-	return
+	x, y, z := tileEntity.Position()
+	return (&proto.ComplexEntityPacket{x, int16(y), z, buf.Bytes()}).Write(writer, proto.AnyVersion)
 }
 
-func WriteDestroyEntity(writer io.Writer, entityID EntityID) os.Error {
-	var packet = struct {
-		PacketID byte
-		EntityID int32
-	}{
-		packetIDDestroyEntity,
+func WriteNamedEntitySpawn(writer io.Writer, entityID EntityID, name string, x, y, z int32, rotation, pitch byte, currentItem int16) os.Error {
+	return (&proto.NamedEntitySpawnPacket{
 		int32(entityID),
-	}
-	return binary.Write(writer, binary.BigEndian, &packet)
-}
-
-func ReadKeepAlive(reader io.Reader, handler PacketHandler) (err os.Error) {
-	handler.PacketKeepAlive()
-	return
-}
-
-func ReadChatMessage(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var length int16
-	err = binary.Read(reader, binary.BigEndian, &length)
-	if err != nil {
-		return
-	}
-
-	bs := make([]byte, length)
-	_, err = io.ReadFull(reader, bs)
-	if err != nil {
-		return
-	}
-
-	// TODO sanitize chat message
-
-	handler.PacketChatMessage(string(bs))
-	return
-}
-
-func WriteChatMessage(writer io.Writer, message string) (err os.Error) {
-	err = binary.Write(writer, binary.BigEndian, byte(packetIDChatMessage))
-	if err != nil {
-		return
-	}
-
-	err = WriteString(writer, message)
-	return
-}
-
-func ReadFlying(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		Flying byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketFlying(byteToBool(packet.Flying))
-	return
+		name,
+		x,
+		y,
+		z,
+		rotation,
+		pitch,
+		currentItem,
+	}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPlayerPosition(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		X      float64
-		Y      float64
-		Stance float64
-		Z      float64
-		Flying byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketPlayerPosition(&XYZ{packet.X, packet.Y, packet.Z}, packet.Stance, byteToBool(packet.Flying))
-	return
+func WritePickupSpawn(writer io.Writer, entityID EntityID, itemID int16, count byte, x, y, z int32, vx, vy, vz int8) os.Error {
+	return (&proto.PickupSpawnPacket{
+		int32(entityID),
+		itemID,
+		count,
+		x,
+		y,
+		z,
+		vx,
+		vy,
+		vz,
+	}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPlayerLook(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		Rotation float32
-		Pitch    float32
-		Flying   byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketPlayerLook(&Orientation{packet.Rotation, packet.Pitch}, byteToBool(packet.Flying))
-	return
+func WriteCollectItem(writer io.Writer, collectedID EntityID, collectorID EntityID) os.Error {
+	return (&proto.CollectItemPacket{int32(collectedID), int32(collectorID)}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPlayerPositionLook(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		X        float64
-		Y        float64
-		Stance   float64
-		Z        float64
-		Rotation float32
-		Pitch    float32
-		Flying   byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketPlayerPosition(&XYZ{packet.X, packet.Y, packet.Z}, packet.Stance, byteToBool(packet.Flying))
-	handler.PacketPlayerLook(&Orientation{packet.Rotation, packet.Pitch}, byteToBool(packet.Flying))
-	return
+func WriteAddObject(writer io.Writer, entityID EntityID, objectType byte, x, y, z int32) os.Error {
+	return (&proto.AddObjectPacket{int32(entityID), objectType, x, y, z}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPlayerDigging(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		Status byte
-		X      int32
-		Y      byte
-		Z      int32
-		Face   byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketPlayerDigging(packet.Status, packet.X, packet.Y, packet.Z, packet.Face)
-	return
+func WriteMobSpawn(writer io.Writer, entityID EntityID, mobType byte, x, y, z int32, rotation, pitch byte) os.Error {
+	return (&proto.MobSpawnPacket{
+		int32(entityID),
+		mobType,
+		x,
+		y,
+		z,
+		rotation,
+		pitch,
+	}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPlayerBlockPlacement(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		ID        int16
-		X         int32
-		Y         byte
-		Z         int32
-		Direction byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketPlayerBlockPlacement(packet.ID, packet.X, packet.Y, packet.Z, packet.Direction)
-	return
+func WriteAddToInventory(writer io.Writer, itemID int16, count byte, life int16) os.Error {
+	return (&proto.AddToInventoryPacket{itemID, count, life}).Write(writer, proto.AnyVersion)
 }
 
-func ReadHoldingChange(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		EntityID    int32
-		BlockItemID int16
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketHoldingChange(packet.BlockItemID)
-	return
+func WriteBlockChange(writer io.Writer, x int32, y byte, z int32, blockType byte, blockMetadata byte) os.Error {
+	return (&proto.BlockChangePacket{x, y, z, blockType, blockMetadata}).Write(writer, proto.AnyVersion)
 }
 
-func ReadArmAnimation(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packet struct {
-		EntityID int32
-		Forward  byte
-	}
-
-	err = binary.Read(reader, binary.BigEndian, &packet)
-	if err != nil {
-		return
-	}
-
-	handler.PacketArmAnimation(byteToBool(packet.Forward))
-	return
+func WriteDestroyEntity(writer io.Writer, entityID EntityID) os.Error {
+	return (&proto.DestroyEntityPacket{int32(entityID)}).Write(writer, proto.AnyVersion)
 }
 
-func ReadDisconnect(reader io.Reader, handler PacketHandler) (err os.Error) {
-	reason, err := ReadString(reader)
-	if err != nil {
-		return
-	}
-
-	handler.PacketDisconnect(reason)
-	return
+func WriteKeepAlive(writer io.Writer) os.Error {
+	return (&proto.KeepAlivePacket{}).Write(writer, proto.AnyVersion)
 }
 
-// Packet reader functions
-var readFns = map[byte]func(io.Reader, PacketHandler) os.Error{
-	packetIDKeepAlive:            ReadKeepAlive,
-	packetIDChatMessage:          ReadChatMessage,
-	packetIDFlying:               ReadFlying,
-	packetIDPlayerPosition:       ReadPlayerPosition,
-	packetIDPlayerLook:           ReadPlayerLook,
-	packetIDPlayerPositionLook:   ReadPlayerPositionLook,
-	packetIDPlayerDigging:        ReadPlayerDigging,
-	packetIDPlayerBlockPlacement: ReadPlayerBlockPlacement,
-	packetIDHoldingChange:        ReadHoldingChange,
-	packetIDArmAnimation:         ReadArmAnimation,
-	packetIDDisconnect:           ReadDisconnect,
+func WriteChatMessage(writer io.Writer, message string) os.Error {
+	return (&proto.ChatMessagePacket{message}).Write(writer, proto.AnyVersion)
 }
 
-func ReadPacket(reader io.Reader, handler PacketHandler) (err os.Error) {
-	var packetID byte
-
-	err = binary.Read(reader, binary.BigEndian, &packetID)
-	if err != nil {
-		return err
-	}
-
-	fn, ok := readFns[packetID]
-	if !ok {
-		return os.NewError(fmt.Sprintf("unhandled packet type %#x", packetID))
-	}
-
-	err = fn(reader, handler)
-	return
+func WriteDisconnect(writer io.Writer, reason string) os.Error {
+	return (&proto.DisconnectPacket{reason}).Write(writer, proto.AnyVersion)
 }
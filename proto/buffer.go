@@ -0,0 +1,79 @@
+// Decoding packets from data that arrives in pieces
+
+package proto
+
+import (
+	"io"
+	"os"
+	"bytes"
+)
+
+// A PacketBuffer collects data sent in one direction, such as the pieces
+// returned by reads from a connection, and splits it into packets
+type PacketBuffer struct {
+	codec       *Codec
+	serverbound bool
+	buf         []byte
+}
+
+// Create a buffer for packets sent by clients if serverbound is true,
+// otherwise for packets sent by servers
+func NewPacketBuffer(codec *Codec, serverbound bool) *PacketBuffer {
+	return &PacketBuffer{codec: codec, serverbound: serverbound}
+}
+
+// Change the protocol version of the following packets
+func (b *PacketBuffer) SetCodec(codec *Codec) {
+	b.codec = codec
+}
+
+func (b *PacketBuffer) Codec() *Codec {
+	return b.codec
+}
+
+// Add data to the buffer
+func (b *PacketBuffer) Write(data []byte) (n int, err os.Error) {
+	joined := make([]byte, len(b.buf)+len(data))
+	copy(joined, b.buf)
+	copy(joined[len(b.buf):], data)
+	b.buf = joined
+	return len(data), nil
+}
+
+// The number of bytes not yet returned by Next
+func (b *PacketBuffer) Len() int {
+	return len(b.buf)
+}
+
+// Remove and return all data not yet returned by Next
+func (b *PacketBuffer) Flush() (data []byte) {
+	data = b.buf
+	b.buf = nil
+	return
+}
+
+// Decode the next packet along with its encoded bytes
+// Returns a nil packet if the buffer does not yet hold a whole packet.
+func (b *PacketBuffer) Next() (packet Packet, data []byte, err os.Error) {
+	if len(b.buf) == 0 {
+		return
+	}
+
+	reader := bytes.NewBuffer(b.buf)
+	if b.serverbound {
+		packet, err = b.codec.ReadServerbound(reader)
+	} else {
+		packet, err = b.codec.ReadClientbound(reader)
+	}
+	if err == os.EOF || err == io.ErrUnexpectedEOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	length := len(b.buf) - reader.Len()
+	data = b.buf[:length]
+	b.buf = b.buf[length:]
+	return
+}
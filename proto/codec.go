@@ -0,0 +1,108 @@
+// Per-version packet codecs
+
+package proto
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"encoding/binary"
+)
+
+// A Codec reads and writes the packets of one protocol version
+// Versions differ in which packets exist and in the layout of some packets.
+// These differences are described in packets.def with "since" annotations, so
+// supporting a new client build means adding to the schema rather than
+// forking the packet code.
+type Codec struct {
+	Version int32
+}
+
+// Supported protocol versions
+var codecs = make(map[int32]*Codec)
+var OldestProtocolVersion, NewestProtocolVersion int32
+
+func registerCodec(codec *Codec) {
+	if len(codecs) == 0 || codec.Version < OldestProtocolVersion {
+		OldestProtocolVersion = codec.Version
+	}
+	if len(codecs) == 0 || codec.Version > NewestProtocolVersion {
+		NewestProtocolVersion = codec.Version
+	}
+	codecs[codec.Version] = codec
+}
+
+func init() {
+	for _, version := range ProtocolVersions {
+		registerCodec(&Codec{version})
+	}
+}
+
+// Find the codec for a client's protocol version
+func LookupCodec(version int32) (codec *Codec, err os.Error) {
+	codec, ok := codecs[version]
+	if !ok {
+		return nil, &UnsupportedVersionError{version}
+	}
+	return
+}
+
+// Read the ID that starts every packet
+func ReadPacketID(reader io.Reader) (packetID byte, err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &packetID)
+	return
+}
+
+func (codec *Codec) readBody(reader io.Reader, packetID byte, newPacket func(byte, int32) Packet) (packet Packet, err os.Error) {
+	packet = newPacket(packetID, codec.Version)
+	if packet == nil {
+		return nil, os.NewError(fmt.Sprintf("unknown packet type %#x for protocol version %d",
+			packetID, codec.Version))
+	}
+
+	err = packet.Read(reader, codec.Version)
+	return
+}
+
+// Read the next packet sent by a client
+func (codec *Codec) ReadServerbound(reader io.Reader) (packet Packet, err os.Error) {
+	packetID, err := ReadPacketID(reader)
+	if err != nil {
+		return
+	}
+	return codec.readBody(reader, packetID, NewServerboundPacket)
+}
+
+// Read the next packet sent by a server
+func (codec *Codec) ReadClientbound(reader io.Reader) (packet Packet, err os.Error) {
+	packetID, err := ReadPacketID(reader)
+	if err != nil {
+		return
+	}
+	return codec.readBody(reader, packetID, NewClientboundPacket)
+}
+
+// Read the rest of a packet sent by a client after its ID
+// Reading the ID separately lets the caller choose the codec once a packet
+// has arrived, for example in a proxy that learns the version from the login
+// request while it is waiting for the server.
+func (codec *Codec) ReadServerboundBody(reader io.Reader, packetID byte) (packet Packet, err os.Error) {
+	return codec.readBody(reader, packetID, NewServerboundPacket)
+}
+
+// Read the rest of a packet sent by a server after its ID
+func (codec *Codec) ReadClientboundBody(reader io.Reader, packetID byte) (packet Packet, err os.Error) {
+	return codec.readBody(reader, packetID, NewClientboundPacket)
+}
+
+func (codec *Codec) Write(writer io.Writer, packet Packet) os.Error {
+	return packet.Write(writer, codec.Version)
+}
+
+func (codec *Codec) WriteLogin(writer io.Writer, entityID int32, mapSeed int64, dimension byte) os.Error {
+	return codec.Write(writer, &LoginReplyPacket{
+		EntityID:  entityID,
+		MapSeed:   mapSeed,
+		Dimension: dimension,
+	})
+}
@@ -0,0 +1,53 @@
+// Packets and packet IDs as text, for the tools that show traffic to people
+
+package proto
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"strconv"
+)
+
+// Parse a comma-separated list of packet IDs, given in decimal or in
+// hexadecimal with a 0x prefix
+func ParseIDList(list string) (ids map[byte]bool, err os.Error) {
+	ids = make(map[byte]bool)
+	for _, s := range strings.Split(list, ",", -1) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		base := 10
+		if strings.HasPrefix(s, "0x") {
+			s, base = s[2:], 16
+		}
+		id, err := strconv.Btoui64(s, base)
+		if err != nil || id > 0xff {
+			return nil, os.NewError("invalid packet ID " + s)
+		}
+		ids[byte(id)] = true
+	}
+	return
+}
+
+// The name of a packet's type, like ChatMessage for *ChatMessagePacket
+func PacketName(packet Packet) string {
+	name := fmt.Sprintf("%T", packet)
+	return name[len("*proto.") : len(name)-len("Packet")]
+}
+
+// Describe a packet on one line by its ID, name and fields
+// Compressed data is only given by its size.
+func Describe(packet Packet) string {
+	fields := fmt.Sprintf("%+v", packet)
+	switch p := packet.(type) {
+	case *MapChunkPacket:
+		fields = fmt.Sprintf("{X:%d Y:%d Z:%d SizeX:%d SizeY:%d SizeZ:%d CompressedData:<%d bytes>}",
+			p.X, p.Y, p.Z, p.SizeX, p.SizeY, p.SizeZ, len(p.CompressedData))
+	case *ComplexEntityPacket:
+		fields = fmt.Sprintf("{X:%d Y:%d Z:%d Payload:<%d bytes>}", p.X, p.Y, p.Z, len(p.Payload))
+	}
+	return fmt.Sprintf("%#02x %s %s", packet.ID(), PacketName(packet), fields)
+}
@@ -0,0 +1,1961 @@
+// Generated by protogen from packets.def, DO NOT EDIT
+
+package proto
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Supported protocol versions
+var ProtocolVersions = []int32{2, 3}
+
+// Packet type IDs
+const (
+	PacketIDKeepAlive                 = 0x00
+	PacketIDLoginRequest              = 0x01
+	PacketIDLoginReply                = 0x01
+	PacketIDHandshakeRequest          = 0x02
+	PacketIDHandshakeReply            = 0x02
+	PacketIDChatMessage               = 0x03
+	PacketIDTimeUpdate                = 0x04
+	PacketIDPlayerInventory           = 0x05
+	PacketIDSpawnPosition             = 0x06
+	PacketIDFlying                    = 0x0a
+	PacketIDPlayerPosition            = 0x0b
+	PacketIDPlayerLook                = 0x0c
+	PacketIDPlayerPositionLook        = 0x0d
+	PacketIDPlayerDigging             = 0x0e
+	PacketIDPlayerBlockPlacement      = 0x0f
+	PacketIDHoldingChange             = 0x10
+	PacketIDAddToInventory            = 0x11
+	PacketIDArmAnimation              = 0x12
+	PacketIDNamedEntitySpawn          = 0x14
+	PacketIDPickupSpawn               = 0x15
+	PacketIDCollectItem               = 0x16
+	PacketIDAddObject                 = 0x17
+	PacketIDMobSpawn                  = 0x18
+	PacketIDEntityVelocity            = 0x1c
+	PacketIDDestroyEntity             = 0x1d
+	PacketIDEntityRelativeMove        = 0x1f
+	PacketIDEntityLook                = 0x20
+	PacketIDEntityLookAndRelativeMove = 0x21
+	PacketIDEntityTeleport            = 0x22
+	PacketIDPreChunk                  = 0x32
+	PacketIDMapChunk                  = 0x33
+	PacketIDBlockChange               = 0x35
+	PacketIDComplexEntity             = 0x3b
+	PacketIDDisconnect                = 0xff
+)
+
+type KeepAlivePacket struct {
+}
+
+func (*KeepAlivePacket) ID() byte {
+	return PacketIDKeepAlive
+}
+
+func (p *KeepAlivePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	return
+}
+
+func (p *KeepAlivePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDKeepAlive))
+	if err != nil {
+		return
+	}
+	return
+}
+
+type LoginRequestPacket struct {
+	ProtocolVersion int32
+	Username        string
+	Password        string
+	MapSeed         int64
+	Dimension       byte
+}
+
+func (*LoginRequestPacket) ID() byte {
+	return PacketIDLoginRequest
+}
+
+func (p *LoginRequestPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.ProtocolVersion)
+	if err != nil {
+		return
+	}
+	version = p.ProtocolVersion
+	p.Username, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	p.Password, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	if version >= 3 {
+		err = binary.Read(reader, binary.BigEndian, &p.MapSeed)
+		if err != nil {
+			return
+		}
+	}
+	if version >= 3 {
+		err = binary.Read(reader, binary.BigEndian, &p.Dimension)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (p *LoginRequestPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDLoginRequest))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.ProtocolVersion)
+	if err != nil {
+		return
+	}
+	version = p.ProtocolVersion
+	err = WriteString(writer, p.Username)
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Password)
+	if err != nil {
+		return
+	}
+	if version >= 3 {
+		err = binary.Write(writer, binary.BigEndian, p.MapSeed)
+		if err != nil {
+			return
+		}
+	}
+	if version >= 3 {
+		err = binary.Write(writer, binary.BigEndian, p.Dimension)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type LoginReplyPacket struct {
+	EntityID  int32
+	Unused1   string
+	Unused2   string
+	MapSeed   int64
+	Dimension byte
+}
+
+func (*LoginReplyPacket) ID() byte {
+	return PacketIDLoginReply
+}
+
+func (p *LoginReplyPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	p.Unused1, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	p.Unused2, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	if version >= 3 {
+		err = binary.Read(reader, binary.BigEndian, &p.MapSeed)
+		if err != nil {
+			return
+		}
+	}
+	if version >= 3 {
+		err = binary.Read(reader, binary.BigEndian, &p.Dimension)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (p *LoginReplyPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDLoginReply))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Unused1)
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Unused2)
+	if err != nil {
+		return
+	}
+	if version >= 3 {
+		err = binary.Write(writer, binary.BigEndian, p.MapSeed)
+		if err != nil {
+			return
+		}
+	}
+	if version >= 3 {
+		err = binary.Write(writer, binary.BigEndian, p.Dimension)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type HandshakeRequestPacket struct {
+	Username string
+}
+
+func (*HandshakeRequestPacket) ID() byte {
+	return PacketIDHandshakeRequest
+}
+
+func (p *HandshakeRequestPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	p.Username, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *HandshakeRequestPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDHandshakeRequest))
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Username)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type HandshakeReplyPacket struct {
+	ConnectionHash string
+}
+
+func (*HandshakeReplyPacket) ID() byte {
+	return PacketIDHandshakeReply
+}
+
+func (p *HandshakeReplyPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	p.ConnectionHash, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *HandshakeReplyPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDHandshakeReply))
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.ConnectionHash)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type ChatMessagePacket struct {
+	Message string
+}
+
+func (*ChatMessagePacket) ID() byte {
+	return PacketIDChatMessage
+}
+
+func (p *ChatMessagePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	p.Message, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *ChatMessagePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDChatMessage))
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Message)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type TimeUpdatePacket struct {
+	Time int64
+}
+
+func (*TimeUpdatePacket) ID() byte {
+	return PacketIDTimeUpdate
+}
+
+func (p *TimeUpdatePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.Time)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *TimeUpdatePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDTimeUpdate))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Time)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerInventoryPacket struct {
+	InventoryType int32
+	Items         []ItemSlot
+}
+
+func (*PlayerInventoryPacket) ID() byte {
+	return PacketIDPlayerInventory
+}
+
+func (p *PlayerInventoryPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.InventoryType)
+	if err != nil {
+		return
+	}
+	p.Items, err = ReadItemSlots(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerInventoryPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerInventory))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.InventoryType)
+	if err != nil {
+		return
+	}
+	err = WriteItemSlots(writer, p.Items)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type SpawnPositionPacket struct {
+	X int32
+	Y int32
+	Z int32
+}
+
+func (*SpawnPositionPacket) ID() byte {
+	return PacketIDSpawnPosition
+}
+
+func (p *SpawnPositionPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *SpawnPositionPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDSpawnPosition))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type FlyingPacket struct {
+	Flying bool
+}
+
+func (*FlyingPacket) ID() byte {
+	return PacketIDFlying
+}
+
+func (p *FlyingPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	p.Flying, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *FlyingPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDFlying))
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.Flying)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerPositionPacket struct {
+	X      float64
+	Y      float64
+	Stance float64
+	Z      float64
+	Flying bool
+}
+
+func (*PlayerPositionPacket) ID() byte {
+	return PacketIDPlayerPosition
+}
+
+func (p *PlayerPositionPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Stance)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	p.Flying, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerPositionPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerPosition))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Stance)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.Flying)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerLookPacket struct {
+	Rotation float32
+	Pitch    float32
+	Flying   bool
+}
+
+func (*PlayerLookPacket) ID() byte {
+	return PacketIDPlayerLook
+}
+
+func (p *PlayerLookPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	p.Flying, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerLookPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerLook))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.Flying)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerPositionLookPacket struct {
+	X        float64
+	Y        float64
+	Stance   float64
+	Z        float64
+	Rotation float32
+	Pitch    float32
+	Flying   bool
+}
+
+func (*PlayerPositionLookPacket) ID() byte {
+	return PacketIDPlayerPositionLook
+}
+
+func (p *PlayerPositionLookPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Stance)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	p.Flying, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerPositionLookPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerPositionLook))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Stance)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.Flying)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerDiggingPacket struct {
+	Status byte
+	X      int32
+	Y      byte
+	Z      int32
+	Face   byte
+}
+
+func (*PlayerDiggingPacket) ID() byte {
+	return PacketIDPlayerDigging
+}
+
+func (p *PlayerDiggingPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.Status)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Face)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerDiggingPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerDigging))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Status)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Face)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PlayerBlockPlacementPacket struct {
+	BlockItemID int16
+	X           int32
+	Y           byte
+	Z           int32
+	Direction   byte
+}
+
+func (*PlayerBlockPlacementPacket) ID() byte {
+	return PacketIDPlayerBlockPlacement
+}
+
+func (p *PlayerBlockPlacementPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.BlockItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Direction)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PlayerBlockPlacementPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPlayerBlockPlacement))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.BlockItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Direction)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type HoldingChangePacket struct {
+	EntityID    int32
+	BlockItemID int16
+}
+
+func (*HoldingChangePacket) ID() byte {
+	return PacketIDHoldingChange
+}
+
+func (p *HoldingChangePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.BlockItemID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *HoldingChangePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDHoldingChange))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.BlockItemID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type AddToInventoryPacket struct {
+	ItemID int16
+	Count  byte
+	Life   int16
+}
+
+func (*AddToInventoryPacket) ID() byte {
+	return PacketIDAddToInventory
+}
+
+func (p *AddToInventoryPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.ItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Count)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Life)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *AddToInventoryPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDAddToInventory))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.ItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Count)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Life)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type ArmAnimationPacket struct {
+	EntityID int32
+	Forward  bool
+}
+
+func (*ArmAnimationPacket) ID() byte {
+	return PacketIDArmAnimation
+}
+
+func (p *ArmAnimationPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	p.Forward, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *ArmAnimationPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDArmAnimation))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.Forward)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type NamedEntitySpawnPacket struct {
+	EntityID    int32
+	Name        string
+	X           int32
+	Y           int32
+	Z           int32
+	Rotation    byte
+	Pitch       byte
+	CurrentItem int16
+}
+
+func (*NamedEntitySpawnPacket) ID() byte {
+	return PacketIDNamedEntitySpawn
+}
+
+func (p *NamedEntitySpawnPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	p.Name, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.CurrentItem)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *NamedEntitySpawnPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDNamedEntitySpawn))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Name)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.CurrentItem)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PickupSpawnPacket struct {
+	EntityID int32
+	ItemID   int16
+	Count    byte
+	X        int32
+	Y        int32
+	Z        int32
+	VX       int8
+	VY       int8
+	VZ       int8
+}
+
+func (*PickupSpawnPacket) ID() byte {
+	return PacketIDPickupSpawn
+}
+
+func (p *PickupSpawnPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.ItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Count)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VX)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VY)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PickupSpawnPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPickupSpawn))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.ItemID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Count)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VX)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VY)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type CollectItemPacket struct {
+	CollectedEntityID int32
+	CollectorEntityID int32
+}
+
+func (*CollectItemPacket) ID() byte {
+	return PacketIDCollectItem
+}
+
+func (p *CollectItemPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.CollectedEntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.CollectorEntityID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *CollectItemPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDCollectItem))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.CollectedEntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.CollectorEntityID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type AddObjectPacket struct {
+	EntityID int32
+	Type     byte
+	X        int32
+	Y        int32
+	Z        int32
+}
+
+func (*AddObjectPacket) ID() byte {
+	return PacketIDAddObject
+}
+
+func (p *AddObjectPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Type)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *AddObjectPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDAddObject))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Type)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type MobSpawnPacket struct {
+	EntityID int32
+	Type     byte
+	X        int32
+	Y        int32
+	Z        int32
+	Rotation byte
+	Pitch    byte
+}
+
+func (*MobSpawnPacket) ID() byte {
+	return PacketIDMobSpawn
+}
+
+func (p *MobSpawnPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Type)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *MobSpawnPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDMobSpawn))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Type)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type EntityVelocityPacket struct {
+	EntityID int32
+	VX       int16
+	VY       int16
+	VZ       int16
+}
+
+func (*EntityVelocityPacket) ID() byte {
+	return PacketIDEntityVelocity
+}
+
+func (p *EntityVelocityPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VX)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VY)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.VZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *EntityVelocityPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDEntityVelocity))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VX)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VY)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.VZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type DestroyEntityPacket struct {
+	EntityID int32
+}
+
+func (*DestroyEntityPacket) ID() byte {
+	return PacketIDDestroyEntity
+}
+
+func (p *DestroyEntityPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *DestroyEntityPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDDestroyEntity))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type EntityRelativeMovePacket struct {
+	EntityID int32
+	DX       int8
+	DY       int8
+	DZ       int8
+}
+
+func (*EntityRelativeMovePacket) ID() byte {
+	return PacketIDEntityRelativeMove
+}
+
+func (p *EntityRelativeMovePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DX)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DY)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *EntityRelativeMovePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDEntityRelativeMove))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DX)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DY)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DZ)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type EntityLookPacket struct {
+	EntityID int32
+	Rotation byte
+	Pitch    byte
+}
+
+func (*EntityLookPacket) ID() byte {
+	return PacketIDEntityLook
+}
+
+func (p *EntityLookPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *EntityLookPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDEntityLook))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type EntityLookAndRelativeMovePacket struct {
+	EntityID int32
+	DX       int8
+	DY       int8
+	DZ       int8
+	Rotation byte
+	Pitch    byte
+}
+
+func (*EntityLookAndRelativeMovePacket) ID() byte {
+	return PacketIDEntityLookAndRelativeMove
+}
+
+func (p *EntityLookAndRelativeMovePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DX)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DY)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.DZ)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *EntityLookAndRelativeMovePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDEntityLookAndRelativeMove))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DX)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DY)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.DZ)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type EntityTeleportPacket struct {
+	EntityID int32
+	X        int32
+	Y        int32
+	Z        int32
+	Rotation byte
+	Pitch    byte
+}
+
+func (*EntityTeleportPacket) ID() byte {
+	return PacketIDEntityTeleport
+}
+
+func (p *EntityTeleportPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *EntityTeleportPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDEntityTeleport))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.EntityID)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Rotation)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Pitch)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PreChunkPacket struct {
+	X        int32
+	Z        int32
+	WillSend bool
+}
+
+func (*PreChunkPacket) ID() byte {
+	return PacketIDPreChunk
+}
+
+func (p *PreChunkPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	p.WillSend, err = ReadBool(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *PreChunkPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDPreChunk))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = WriteBool(writer, p.WillSend)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type MapChunkPacket struct {
+	X              int32
+	Y              int16
+	Z              int32
+	SizeX          byte
+	SizeY          byte
+	SizeZ          byte
+	CompressedData []byte
+}
+
+func (*MapChunkPacket) ID() byte {
+	return PacketIDMapChunk
+}
+
+func (p *MapChunkPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.SizeX)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.SizeY)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.SizeZ)
+	if err != nil {
+		return
+	}
+	p.CompressedData, err = ReadByteArray(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *MapChunkPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDMapChunk))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.SizeX)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.SizeY)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.SizeZ)
+	if err != nil {
+		return
+	}
+	err = WriteByteArray(writer, p.CompressedData)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type BlockChangePacket struct {
+	X             int32
+	Y             byte
+	Z             int32
+	BlockType     byte
+	BlockMetadata byte
+}
+
+func (*BlockChangePacket) ID() byte {
+	return PacketIDBlockChange
+}
+
+func (p *BlockChangePacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.BlockType)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.BlockMetadata)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *BlockChangePacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDBlockChange))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.BlockType)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.BlockMetadata)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type ComplexEntityPacket struct {
+	X       int32
+	Y       int16
+	Z       int32
+	Payload []byte
+}
+
+func (*ComplexEntityPacket) ID() byte {
+	return PacketIDComplexEntity
+}
+
+func (p *ComplexEntityPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	err = binary.Read(reader, binary.BigEndian, &p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &p.Z)
+	if err != nil {
+		return
+	}
+	p.Payload, err = ReadShortByteArray(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *ComplexEntityPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDComplexEntity))
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.X)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Y)
+	if err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, p.Z)
+	if err != nil {
+		return
+	}
+	err = WriteShortByteArray(writer, p.Payload)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type DisconnectPacket struct {
+	Reason string
+}
+
+func (*DisconnectPacket) ID() byte {
+	return PacketIDDisconnect
+}
+
+func (p *DisconnectPacket) Read(reader io.Reader, version int32) (err os.Error) {
+	p.Reason, err = ReadString(reader)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *DisconnectPacket) Write(writer io.Writer, version int32) (err os.Error) {
+	err = binary.Write(writer, binary.BigEndian, byte(PacketIDDisconnect))
+	if err != nil {
+		return
+	}
+	err = WriteString(writer, p.Reason)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// Create an empty packet of a type sent by clients
+// Returns nil if the packet does not exist in this protocol version.
+func NewServerboundPacket(packetID byte, version int32) Packet {
+	switch packetID {
+	case PacketIDKeepAlive:
+		return &KeepAlivePacket{}
+	case PacketIDLoginRequest:
+		return &LoginRequestPacket{}
+	case PacketIDHandshakeRequest:
+		return &HandshakeRequestPacket{}
+	case PacketIDChatMessage:
+		return &ChatMessagePacket{}
+	case PacketIDFlying:
+		return &FlyingPacket{}
+	case PacketIDPlayerPosition:
+		return &PlayerPositionPacket{}
+	case PacketIDPlayerLook:
+		return &PlayerLookPacket{}
+	case PacketIDPlayerPositionLook:
+		return &PlayerPositionLookPacket{}
+	case PacketIDPlayerDigging:
+		return &PlayerDiggingPacket{}
+	case PacketIDPlayerBlockPlacement:
+		return &PlayerBlockPlacementPacket{}
+	case PacketIDHoldingChange:
+		return &HoldingChangePacket{}
+	case PacketIDArmAnimation:
+		return &ArmAnimationPacket{}
+	case PacketIDPickupSpawn:
+		return &PickupSpawnPacket{}
+	case PacketIDDisconnect:
+		return &DisconnectPacket{}
+	}
+	return nil
+}
+
+// Create an empty packet of a type sent by servers
+// Returns nil if the packet does not exist in this protocol version.
+func NewClientboundPacket(packetID byte, version int32) Packet {
+	switch packetID {
+	case PacketIDKeepAlive:
+		return &KeepAlivePacket{}
+	case PacketIDLoginReply:
+		return &LoginReplyPacket{}
+	case PacketIDHandshakeReply:
+		return &HandshakeReplyPacket{}
+	case PacketIDChatMessage:
+		return &ChatMessagePacket{}
+	case PacketIDTimeUpdate:
+		return &TimeUpdatePacket{}
+	case PacketIDPlayerInventory:
+		return &PlayerInventoryPacket{}
+	case PacketIDSpawnPosition:
+		return &SpawnPositionPacket{}
+	case PacketIDFlying:
+		return &FlyingPacket{}
+	case PacketIDPlayerPosition:
+		return &PlayerPositionPacket{}
+	case PacketIDPlayerLook:
+		return &PlayerLookPacket{}
+	case PacketIDPlayerPositionLook:
+		return &PlayerPositionLookPacket{}
+	case PacketIDHoldingChange:
+		return &HoldingChangePacket{}
+	case PacketIDAddToInventory:
+		return &AddToInventoryPacket{}
+	case PacketIDArmAnimation:
+		return &ArmAnimationPacket{}
+	case PacketIDNamedEntitySpawn:
+		return &NamedEntitySpawnPacket{}
+	case PacketIDPickupSpawn:
+		return &PickupSpawnPacket{}
+	case PacketIDCollectItem:
+		return &CollectItemPacket{}
+	case PacketIDAddObject:
+		return &AddObjectPacket{}
+	case PacketIDMobSpawn:
+		return &MobSpawnPacket{}
+	case PacketIDEntityVelocity:
+		return &EntityVelocityPacket{}
+	case PacketIDDestroyEntity:
+		return &DestroyEntityPacket{}
+	case PacketIDEntityRelativeMove:
+		return &EntityRelativeMovePacket{}
+	case PacketIDEntityLook:
+		return &EntityLookPacket{}
+	case PacketIDEntityLookAndRelativeMove:
+		return &EntityLookAndRelativeMovePacket{}
+	case PacketIDEntityTeleport:
+		return &EntityTeleportPacket{}
+	case PacketIDPreChunk:
+		return &PreChunkPacket{}
+	case PacketIDMapChunk:
+		return &MapChunkPacket{}
+	case PacketIDBlockChange:
+		return &BlockChangePacket{}
+	case PacketIDComplexEntity:
+		return &ComplexEntityPacket{}
+	case PacketIDDisconnect:
+		return &DisconnectPacket{}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+// Generated by protogen from packets.def, DO NOT EDIT
+
+package proto
+
+import (
+	"os"
+	"testing"
+)
+
+// Check that every packet of a protocol version survives being written and
+// read back through the lookup tables
+func checkRoundTrips(version int32) (err os.Error) {
+	err = checkPacketRoundTrip(version,
+		&KeepAlivePacket{},
+		NewServerboundPacket(PacketIDKeepAlive, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&KeepAlivePacket{},
+		NewClientboundPacket(PacketIDKeepAlive, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&LoginRequestPacket{version, "sample", "sample", -1234567890123, 7},
+		NewServerboundPacket(PacketIDLoginRequest, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&LoginReplyPacket{-123456, "sample", "sample", -1234567890123, 7},
+		NewClientboundPacket(PacketIDLoginReply, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&HandshakeRequestPacket{"sample"},
+		NewServerboundPacket(PacketIDHandshakeRequest, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&HandshakeReplyPacket{"sample"},
+		NewClientboundPacket(PacketIDHandshakeReply, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&ChatMessagePacket{"sample"},
+		NewServerboundPacket(PacketIDChatMessage, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&ChatMessagePacket{"sample"},
+		NewClientboundPacket(PacketIDChatMessage, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&TimeUpdatePacket{-1234567890123},
+		NewClientboundPacket(PacketIDTimeUpdate, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerInventoryPacket{-123456, []ItemSlot{ItemSlot{-1, 0, 0}, ItemSlot{1, 64, 3}}},
+		NewClientboundPacket(PacketIDPlayerInventory, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&SpawnPositionPacket{-123456, -123456, -123456},
+		NewClientboundPacket(PacketIDSpawnPosition, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&FlyingPacket{true},
+		NewServerboundPacket(PacketIDFlying, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&FlyingPacket{true},
+		NewClientboundPacket(PacketIDFlying, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerPositionPacket{-2.25, -2.25, -2.25, -2.25, true},
+		NewServerboundPacket(PacketIDPlayerPosition, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerPositionPacket{-2.25, -2.25, -2.25, -2.25, true},
+		NewClientboundPacket(PacketIDPlayerPosition, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerLookPacket{1.5, 1.5, true},
+		NewServerboundPacket(PacketIDPlayerLook, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerLookPacket{1.5, 1.5, true},
+		NewClientboundPacket(PacketIDPlayerLook, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerPositionLookPacket{-2.25, -2.25, -2.25, -2.25, 1.5, 1.5, true},
+		NewServerboundPacket(PacketIDPlayerPositionLook, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerPositionLookPacket{-2.25, -2.25, -2.25, -2.25, 1.5, 1.5, true},
+		NewClientboundPacket(PacketIDPlayerPositionLook, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerDiggingPacket{7, -123456, 7, -123456, 7},
+		NewServerboundPacket(PacketIDPlayerDigging, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PlayerBlockPlacementPacket{-1234, -123456, 7, -123456, 7},
+		NewServerboundPacket(PacketIDPlayerBlockPlacement, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&HoldingChangePacket{-123456, -1234},
+		NewServerboundPacket(PacketIDHoldingChange, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&HoldingChangePacket{-123456, -1234},
+		NewClientboundPacket(PacketIDHoldingChange, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&AddToInventoryPacket{-1234, 7, -1234},
+		NewClientboundPacket(PacketIDAddToInventory, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&ArmAnimationPacket{-123456, true},
+		NewServerboundPacket(PacketIDArmAnimation, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&ArmAnimationPacket{-123456, true},
+		NewClientboundPacket(PacketIDArmAnimation, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&NamedEntitySpawnPacket{-123456, "sample", -123456, -123456, -123456, 7, 7, -1234},
+		NewClientboundPacket(PacketIDNamedEntitySpawn, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PickupSpawnPacket{-123456, -1234, 7, -123456, -123456, -123456, -7, -7, -7},
+		NewServerboundPacket(PacketIDPickupSpawn, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PickupSpawnPacket{-123456, -1234, 7, -123456, -123456, -123456, -7, -7, -7},
+		NewClientboundPacket(PacketIDPickupSpawn, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&CollectItemPacket{-123456, -123456},
+		NewClientboundPacket(PacketIDCollectItem, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&AddObjectPacket{-123456, 7, -123456, -123456, -123456},
+		NewClientboundPacket(PacketIDAddObject, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&MobSpawnPacket{-123456, 7, -123456, -123456, -123456, 7, 7},
+		NewClientboundPacket(PacketIDMobSpawn, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&EntityVelocityPacket{-123456, -1234, -1234, -1234},
+		NewClientboundPacket(PacketIDEntityVelocity, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&DestroyEntityPacket{-123456},
+		NewClientboundPacket(PacketIDDestroyEntity, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&EntityRelativeMovePacket{-123456, -7, -7, -7},
+		NewClientboundPacket(PacketIDEntityRelativeMove, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&EntityLookPacket{-123456, 7, 7},
+		NewClientboundPacket(PacketIDEntityLook, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&EntityLookAndRelativeMovePacket{-123456, -7, -7, -7, 7, 7},
+		NewClientboundPacket(PacketIDEntityLookAndRelativeMove, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&EntityTeleportPacket{-123456, -123456, -123456, -123456, 7, 7},
+		NewClientboundPacket(PacketIDEntityTeleport, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&PreChunkPacket{-123456, -123456, true},
+		NewClientboundPacket(PacketIDPreChunk, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&MapChunkPacket{-123456, -1234, -123456, 7, 7, 7, []byte{1, 2, 3}},
+		NewClientboundPacket(PacketIDMapChunk, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&BlockChangePacket{-123456, 7, -123456, 7, 7},
+		NewClientboundPacket(PacketIDBlockChange, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&ComplexEntityPacket{-123456, -1234, -123456, []byte{4, 5}},
+		NewClientboundPacket(PacketIDComplexEntity, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&DisconnectPacket{"sample"},
+		NewServerboundPacket(PacketIDDisconnect, version))
+	if err != nil {
+		return
+	}
+	err = checkPacketRoundTrip(version,
+		&DisconnectPacket{"sample"},
+		NewClientboundPacket(PacketIDDisconnect, version))
+	if err != nil {
+		return
+	}
+	return
+}
+
+func TestRoundTrips(t *testing.T) {
+	for _, version := range ProtocolVersions {
+		err := checkRoundTrips(version)
+		if err != nil {
+			t.Errorf("protocol version %d: %s", version, err.String())
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Generate packet encoders and decoders from packets.def
+//
+// usage: protogen < packets.def > packets.go
+//        protogen --test < packets.def > packets_test.go
+//
+// The generated code belongs to package proto.  With --test, protogen instead
+// generates a test that every packet survives a round trip.
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"log"
+	"flag"
+	"bytes"
+	"bufio"
+	"strings"
+	"strconv"
+)
+
+type fieldType struct {
+	goType  string
+	readFn  string // empty for fixed size types handled by encoding/binary
+	writeFn string
+	sample  string // value used in round-trip checks
+}
+
+var fieldTypes = map[string]fieldType{
+	"byte":       fieldType{"byte", "", "", "7"},
+	"int8":       fieldType{"int8", "", "", "-7"},
+	"bool":       fieldType{"bool", "ReadBool", "WriteBool", "true"},
+	"int16":      fieldType{"int16", "", "", "-1234"},
+	"int32":      fieldType{"int32", "", "", "-123456"},
+	"int64":      fieldType{"int64", "", "", "-1234567890123"},
+	"float32":    fieldType{"float32", "", "", "1.5"},
+	"float64":    fieldType{"float64", "", "", "-2.25"},
+	"string":     fieldType{"string", "ReadString", "WriteString", `"sample"`},
+	"bytes":      fieldType{"[]byte", "ReadByteArray", "WriteByteArray", "[]byte{1, 2, 3}"},
+	"shortbytes": fieldType{"[]byte", "ReadShortByteArray", "WriteShortByteArray", "[]byte{4, 5}"},
+	"items":      fieldType{"[]ItemSlot", "ReadItemSlots", "WriteItemSlots", "[]ItemSlot{ItemSlot{-1, 0, 0}, ItemSlot{1, 64, 3}}"},
+	"metadata":   fieldType{"EntityMetadata", "ReadEntityMetadata", "WriteEntityMetadata", `EntityMetadata{MetadataEntry{0, byte(1)}, MetadataEntry{1, "sample"}}`},
+}
+
+var genTest = flag.Bool("test", false, "generate the round-trip test instead of the packet code")
+
+// The field that selects the protocol version for the rest of its packet
+const versionField = "ProtocolVersion"
+
+type field struct {
+	name  string
+	typ   fieldType
+	since int
+}
+
+type packet struct {
+	name      string
+	id        byte
+	direction string
+	since     int
+	fields    []*field
+}
+
+func (p *packet) addField(f *field) {
+	n := len(p.fields)
+	if n == cap(p.fields) {
+		grown := make([]*field, n, 2*n+1)
+		copy(grown, p.fields)
+		p.fields = grown
+	}
+	p.fields = p.fields[0 : n+1]
+	p.fields[n] = f
+}
+
+type schema struct {
+	versions []int
+	packets  []*packet
+}
+
+func (s *schema) addVersion(version int) {
+	n := len(s.versions)
+	if n == cap(s.versions) {
+		grown := make([]int, n, 2*n+1)
+		copy(grown, s.versions)
+		s.versions = grown
+	}
+	s.versions = s.versions[0 : n+1]
+	s.versions[n] = version
+}
+
+func (s *schema) addPacket(p *packet) {
+	n := len(s.packets)
+	if n == cap(s.packets) {
+		grown := make([]*packet, n, 2*n+1)
+		copy(grown, s.packets)
+		s.packets = grown
+	}
+	s.packets = s.packets[0 : n+1]
+	s.packets[n] = p
+}
+
+func parseFail(lineNum int, message string) {
+	log.Exit(fmt.Sprintf("packets.def:%d: %s", lineNum, message))
+}
+
+// Parse an optional trailing "since <version>"
+func parseSince(words []string, lineNum int) int {
+	if len(words) == 0 {
+		return 0
+	}
+	if len(words) != 2 || words[0] != "since" {
+		parseFail(lineNum, "expected \"since <version>\"")
+	}
+
+	since, err := strconv.Atoi(words[1])
+	if err != nil {
+		parseFail(lineNum, "invalid version "+words[1])
+	}
+	return since
+}
+
+func parseID(s string, lineNum int) byte {
+	if !strings.HasPrefix(s, "0x") {
+		parseFail(lineNum, "packet ID must be hexadecimal")
+	}
+
+	id, err := strconv.Btoui64(s[2:], 16)
+	if err != nil || id > 0xff {
+		parseFail(lineNum, "invalid packet ID "+s)
+	}
+	return byte(id)
+}
+
+func parseSchema(reader *bufio.Reader) *schema {
+	s := &schema{}
+	var current *packet
+
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err == os.EOF && line == "" {
+			break
+		}
+		if err != nil && err != os.EOF {
+			log.Exit("reading schema: ", err.String())
+		}
+
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		switch {
+		case words[0] == "version":
+			if len(words) != 2 {
+				parseFail(lineNum, "expected \"version <number>\"")
+			}
+			version, err := strconv.Atoi(words[1])
+			if err != nil {
+				parseFail(lineNum, "invalid version "+words[1])
+			}
+			s.addVersion(version)
+
+		case words[0] == "packet":
+			if len(words) < 4 {
+				parseFail(lineNum, "expected \"packet <Name> <ID> <direction>\"")
+			}
+			direction := words[3]
+			if direction != "toServer" && direction != "toClient" && direction != "both" {
+				parseFail(lineNum, "invalid direction "+direction)
+			}
+			current = &packet{
+				name:      words[1],
+				id:        parseID(words[2], lineNum),
+				direction: direction,
+				since:     parseSince(words[4:], lineNum),
+			}
+			s.addPacket(current)
+
+		default:
+			if current == nil {
+				parseFail(lineNum, "field outside of packet")
+			}
+			if len(words) < 2 {
+				parseFail(lineNum, "expected \"<Field> <type>\"")
+			}
+			typ, ok := fieldTypes[words[1]]
+			if !ok {
+				parseFail(lineNum, "unknown type "+words[1])
+			}
+			current.addField(&field{words[0], typ, parseSince(words[2:], lineNum)})
+		}
+	}
+
+	if len(s.versions) == 0 {
+		log.Exit("packets.def: no protocol versions")
+	}
+	return s
+}
+
+type generator struct {
+	bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g, format, args...)
+}
+
+func (g *generator) header(s *schema) {
+	g.printf("// Generated by protogen from packets.def, DO NOT EDIT\n\n")
+	g.printf("package proto\n\n")
+	g.printf("import (\n\t\"encoding/binary\"\n\t\"io\"\n\t\"os\"\n)\n\n")
+
+	g.printf("// Supported protocol versions\n")
+	g.printf("var ProtocolVersions = []int32{")
+	for i, version := range s.versions {
+		if i > 0 {
+			g.printf(", ")
+		}
+		g.printf("%d", version)
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Packet type IDs\n")
+	g.printf("const (\n")
+	for _, p := range s.packets {
+		g.printf("\tPacketID%s = 0x%02x\n", p.name, p.id)
+	}
+	g.printf(")\n")
+}
+
+func (g *generator) structType(p *packet) {
+	g.printf("\ntype %sPacket struct {\n", p.name)
+	for _, f := range p.fields {
+		g.printf("\t%s %s\n", f.name, f.typ.goType)
+	}
+	g.printf("}\n")
+
+	g.printf("\nfunc (*%sPacket) ID() byte {\n", p.name)
+	g.printf("\treturn PacketID%s\n", p.name)
+	g.printf("}\n")
+}
+
+// Emit statements for each field, wrapping fields that depend on the protocol
+// version in a condition
+func (g *generator) fieldStatements(p *packet, statement func(f *field, indent string)) {
+	for _, f := range p.fields {
+		indent := "\t"
+		if f.since > 0 {
+			g.printf("\tif version >= %d {\n", f.since)
+			indent = "\t\t"
+		}
+
+		statement(f, indent)
+		if f.name == versionField {
+			g.printf("%sversion = p.%s\n", indent, f.name)
+		}
+
+		if f.since > 0 {
+			g.printf("\t}\n")
+		}
+	}
+}
+
+func (g *generator) checkErr(indent string) {
+	g.printf("%sif err != nil {\n%s\treturn\n%s}\n", indent, indent, indent)
+}
+
+func (g *generator) readMethod(p *packet) {
+	g.printf("\nfunc (p *%sPacket) Read(reader io.Reader, version int32) (err os.Error) {\n", p.name)
+	g.fieldStatements(p, func(f *field, indent string) {
+		if f.typ.readFn == "" {
+			g.printf("%serr = binary.Read(reader, binary.BigEndian, &p.%s)\n", indent, f.name)
+		} else {
+			g.printf("%sp.%s, err = %s(reader)\n", indent, f.name, f.typ.readFn)
+		}
+		g.checkErr(indent)
+	})
+	g.printf("\treturn\n")
+	g.printf("}\n")
+}
+
+func (g *generator) writeMethod(p *packet) {
+	g.printf("\nfunc (p *%sPacket) Write(writer io.Writer, version int32) (err os.Error) {\n", p.name)
+	g.printf("\terr = binary.Write(writer, binary.BigEndian, byte(PacketID%s))\n", p.name)
+	g.checkErr("\t")
+	g.fieldStatements(p, func(f *field, indent string) {
+		if f.typ.writeFn == "" {
+			g.printf("%serr = binary.Write(writer, binary.BigEndian, p.%s)\n", indent, f.name)
+		} else {
+			g.printf("%serr = %s(writer, p.%s)\n", indent, f.typ.writeFn, f.name)
+		}
+		g.checkErr(indent)
+	})
+	g.printf("\treturn\n")
+	g.printf("}\n")
+}
+
+func sendsTo(p *packet, direction string) bool {
+	return p.direction == direction || p.direction == "both"
+}
+
+// Emit a constructor that looks up packets by ID, like nbt.NewTagByType
+func (g *generator) constructor(s *schema, funcName string, direction string, comment string) {
+	g.printf("\n// %s\n", comment)
+	g.printf("// Returns nil if the packet does not exist in this protocol version.\n")
+	g.printf("func %s(packetID byte, version int32) Packet {\n", funcName)
+	g.printf("\tswitch packetID {\n")
+	for _, p := range s.packets {
+		if !sendsTo(p, direction) {
+			continue
+		}
+
+		g.printf("\tcase PacketID%s:\n", p.name)
+		if p.since > 0 {
+			g.printf("\t\tif version >= %d {\n", p.since)
+			g.printf("\t\t\treturn &%sPacket{}\n", p.name)
+			g.printf("\t\t}\n")
+		} else {
+			g.printf("\t\treturn &%sPacket{}\n", p.name)
+		}
+	}
+	g.printf("\t}\n")
+	g.printf("\treturn nil\n")
+	g.printf("}\n")
+}
+
+func (g *generator) roundTripCheck(p *packet, constructor string, indent string) {
+	g.printf("%serr = checkPacketRoundTrip(version,\n", indent)
+	g.printf("%s\t&%sPacket{", indent, p.name)
+	for i, f := range p.fields {
+		if i > 0 {
+			g.printf(", ")
+		}
+		if f.name == versionField {
+			g.printf("version")
+		} else {
+			g.printf("%s", f.typ.sample)
+		}
+	}
+	g.printf("},\n")
+	g.printf("%s\t%s(PacketID%s, version))\n", indent, constructor, p.name)
+	g.checkErr(indent)
+}
+
+func (g *generator) roundTripChecks(s *schema) {
+	g.printf("// Generated by protogen from packets.def, DO NOT EDIT\n\n")
+	g.printf("package proto\n\n")
+	g.printf("import (\n\t\"os\"\n\t\"testing\"\n)\n")
+
+	g.printf("\n// Check that every packet of a protocol version survives being written and\n")
+	g.printf("// read back through the lookup tables\n")
+	g.printf("func checkRoundTrips(version int32) (err os.Error) {\n")
+	for _, p := range s.packets {
+		indent := "\t"
+		if p.since > 0 {
+			g.printf("\tif version >= %d {\n", p.since)
+			indent = "\t\t"
+		}
+
+		if sendsTo(p, "toServer") {
+			g.roundTripCheck(p, "NewServerboundPacket", indent)
+		}
+		if sendsTo(p, "toClient") {
+			g.roundTripCheck(p, "NewClientboundPacket", indent)
+		}
+
+		if p.since > 0 {
+			g.printf("\t}\n")
+		}
+	}
+	g.printf("\treturn\n")
+	g.printf("}\n")
+
+	g.printf("\nfunc TestRoundTrips(t *testing.T) {\n")
+	g.printf("\tfor _, version := range ProtocolVersions {\n")
+	g.printf("\t\terr := checkRoundTrips(version)\n")
+	g.printf("\t\tif err != nil {\n")
+	g.printf("\t\t\tt.Errorf(\"protocol version %%d: %%s\", version, err.String())\n")
+	g.printf("\t\t}\n")
+	g.printf("\t}\n")
+	g.printf("}\n")
+}
+
+func main() {
+	flag.Parse()
+	s := parseSchema(bufio.NewReader(os.Stdin))
+
+	g := &generator{}
+	if *genTest {
+		g.roundTripChecks(s)
+	} else {
+		g.header(s)
+		for _, p := range s.packets {
+			g.structType(p)
+			g.readMethod(p)
+			g.writeMethod(p)
+		}
+		g.constructor(s, "NewServerboundPacket", "toServer", "Create an empty packet of a type sent by clients")
+		g.constructor(s, "NewClientboundPacket", "toClient", "Create an empty packet of a type sent by servers")
+	}
+
+	_, err := os.Stdout.Write(g.Bytes())
+	if err != nil {
+		log.Exit("writing output: ", err.String())
+	}
+}
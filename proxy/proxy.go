@@ -0,0 +1,251 @@
+// Packet-inspecting proxy for debugging clients and servers
+//
+// usage: proxy [flags] <server address>
+//
+// Clients connect to the proxy, which forwards their connection to the
+// server.  Every packet is decoded in both directions and logged.  Selected
+// packet types can be dropped or rewritten on the way through.
+//
+// Packets that are not in packets.def cannot be decoded, so nothing is known
+// about where the next packet starts.  From the first such packet on, the
+// rest of its direction is forwarded untouched.
+
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"log"
+	"net"
+	"sync"
+	"bytes"
+	"proto"
+)
+
+var listenAddr = flag.String("listen", ":25566", "address to accept clients on")
+var dropIDs = flag.String("drop", "", "comma-separated packet IDs to drop, e.g. 0x04,0x12")
+var hideIDs = flag.String("hide", "", "comma-separated packet IDs to forward without logging")
+var rewriteNames = flag.String("rewrite", "", "comma-separated rewriters to apply: freeze-time, tag-chat")
+var maxLineLength = flag.Int("max-line-length", 200, "truncate logged packets to this many characters")
+
+// Filters and rewriters selected on the command line
+type policy struct {
+	drop      map[byte]bool
+	hide      map[byte]bool
+	rewriters []Rewriter
+}
+
+// A connection from a client that is forwarded to the server
+type session struct {
+	id     int
+	policy *policy
+
+	// The protocol version is unknown until the client sends its login
+	// request, but the packets before it are the same in all versions.
+	lock  sync.Mutex
+	codec *proto.Codec
+}
+
+func (s *session) getCodec() *proto.Codec {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.codec
+}
+
+func (s *session) setCodec(codec *proto.Codec) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.codec = codec
+}
+
+func (s *session) log(arrow string, text string) {
+	line := fmt.Sprintf("#%d %s %s", s.id, arrow, text)
+	if len(line) > *maxLineLength {
+		line = line[:*maxLineLength] + "..."
+	}
+	log.Stderr(line)
+}
+
+// A reader that keeps a copy of everything read through it
+type copyingReader struct {
+	reader io.Reader
+	copy   *bytes.Buffer
+}
+
+func (r *copyingReader) Read(b []byte) (n int, err os.Error) {
+	n, err = r.reader.Read(b)
+	r.copy.Write(b[:n])
+	return
+}
+
+// Forward packets in one direction until either side closes
+func (s *session) relay(src, dst net.Conn, toServer bool) (err os.Error) {
+	arrow := "<-"
+	if toServer {
+		arrow = "->"
+	}
+
+	// The bytes of the current packet, to forward if it cannot be decoded
+	raw := &bytes.Buffer{}
+	reader := &copyingReader{src, raw}
+
+	for {
+		raw.Reset()
+
+		var id byte
+		id, err = proto.ReadPacketID(reader)
+		if err != nil {
+			return
+		}
+
+		// The codec is only looked up once a packet has arrived.  The read
+		// from the server is already waiting when the client's login request
+		// changes the version, and the login reply must be read in the new
+		// version.
+		codec := s.getCodec()
+		var packet proto.Packet
+		if toServer {
+			packet, err = codec.ReadServerboundBody(reader, id)
+		} else {
+			packet, err = codec.ReadClientboundBody(reader, id)
+		}
+		if err == os.EOF {
+			return
+		}
+		if err != nil {
+			s.log(arrow, fmt.Sprintf("cannot decode packet %#02x, forwarding the rest without decoding: %s",
+				id, err.String()))
+			return forwardRaw(src, dst, raw.Bytes())
+		}
+
+		if login, ok := packet.(*proto.LoginRequestPacket); ok {
+			loginCodec, err := proto.LookupCodec(login.ProtocolVersion)
+			if err != nil {
+				// Forward the packet anyway so the server can reject it
+				s.log(arrow, err.String())
+			} else {
+				s.setCodec(loginCodec)
+				codec = loginCodec
+			}
+		}
+
+		if s.policy.drop[id] {
+			if !s.policy.hide[id] {
+				s.log(arrow, "dropped "+proto.Describe(packet))
+			}
+			continue
+		}
+
+		for _, rewrite := range s.policy.rewriters {
+			packet = rewrite(packet, toServer)
+		}
+
+		if !s.policy.hide[id] {
+			s.log(arrow, proto.Describe(packet))
+		}
+
+		// Encode first so that a packet is written with a single call
+		buf := &bytes.Buffer{}
+		err = codec.Write(buf, packet)
+		if err != nil {
+			return
+		}
+		_, err = dst.Write(buf.Bytes())
+		if err != nil {
+			return
+		}
+	}
+	panic("unreachable")
+}
+
+// Forward the start of a packet and then everything after it unchanged
+func forwardRaw(src, dst net.Conn, start []byte) os.Error {
+	_, err := dst.Write(start)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (s *session) run(clientConn net.Conn, serverAddr string) {
+	defer clientConn.Close()
+
+	serverConn, err := net.Dial("tcp", "", serverAddr)
+	if err != nil {
+		s.log("--", "connecting to server: "+err.String())
+		return
+	}
+	defer serverConn.Close()
+
+	s.log("--", "client "+clientConn.RemoteAddr().String()+" connected")
+
+	done := make(chan os.Error, 2)
+	go func() {
+		done <- s.relay(clientConn, serverConn, true)
+	}()
+	go func() {
+		done <- s.relay(serverConn, clientConn, false)
+	}()
+
+	// Closing both connections ends the other relay
+	err = <-done
+	if err != nil && err != os.EOF {
+		s.log("--", err.String())
+	}
+	clientConn.Close()
+	serverConn.Close()
+	<-done
+	s.log("--", "closed")
+}
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <server address>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	serverAddr := flag.Arg(0)
+
+	p := &policy{}
+	var err os.Error
+	p.drop, err = proto.ParseIDList(*dropIDs)
+	if err != nil {
+		log.Exit("--drop: ", err.String())
+	}
+	p.hide, err = proto.ParseIDList(*hideIDs)
+	if err != nil {
+		log.Exit("--hide: ", err.String())
+	}
+	p.rewriters, err = lookupRewriters(*rewriteNames)
+	if err != nil {
+		log.Exit("--rewrite: ", err.String())
+	}
+
+	listener, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		log.Exit("Listen: ", err.String())
+	}
+	log.Stderr("Proxying ", *listenAddr, " to ", serverAddr)
+
+	initialCodec, _ := proto.LookupCodec(proto.OldestProtocolVersion)
+	for id := 1; ; id++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Stderr("Accept: ", err.String())
+			continue
+		}
+
+		s := &session{id: id, policy: p, codec: initialCodec}
+		go s.run(conn, serverAddr)
+	}
+}
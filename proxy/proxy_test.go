@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"bytes"
+	"testing"
+	"proto"
+)
+
+// Write a packet from another goroutine, since writes to a pipe wait for the
+// other end to read
+func writeLater(t *testing.T, conn net.Conn, codec *proto.Codec, packets ...proto.Packet) {
+	go func() {
+		for _, packet := range packets {
+			err := codec.Write(conn, packet)
+			if err != nil {
+				t.Error("Write: ", err.String())
+				return
+			}
+		}
+	}()
+}
+
+func readPacket(t *testing.T, conn net.Conn, codec *proto.Codec, toServer bool) proto.Packet {
+	var packet proto.Packet
+	var err os.Error
+	if toServer {
+		packet, err = codec.ReadServerbound(conn)
+	} else {
+		packet, err = codec.ReadClientbound(conn)
+	}
+	if err != nil {
+		t.Fatal("Read: ", err.String())
+	}
+	return packet
+}
+
+// A connection that reports how many bytes have been read from it whenever a
+// read starts, so a test can tell when a relay has used up everything sent to
+// it and is waiting for more
+type watchedConn struct {
+	net.Conn
+	read    int
+	reading chan int
+}
+
+func newWatchedConn(conn net.Conn) *watchedConn {
+	return &watchedConn{Conn: conn, reading: make(chan int, 64)}
+}
+
+func (conn *watchedConn) Read(b []byte) (n int, err os.Error) {
+	select {
+	case conn.reading <- conn.read:
+	default: // nobody is watching anymore
+	}
+	n, err = conn.Conn.Read(b)
+	conn.read += n
+	return
+}
+
+// Wait until a read starts after n bytes have been read
+func (conn *watchedConn) waitForRead(n int) {
+	for read := range conn.reading {
+		if read == n {
+			return
+		}
+	}
+}
+
+// Relay between the proxy's ends of two pipes.  Like run, close both
+// connections when either relay stops, so that a garbled stream makes reads
+// from the other ends fail instead of waiting forever.
+func startRelays(s *session, proxyClientConn, proxyServerConn net.Conn) {
+	relay := func(src, dst net.Conn, toServer bool) {
+		s.relay(src, dst, toServer)
+		proxyClientConn.Close()
+		proxyServerConn.Close()
+	}
+	go relay(proxyClientConn, proxyServerConn, true)
+	go relay(proxyServerConn, proxyClientConn, false)
+}
+
+// A version 3 login passes through a session that starts out in version 2,
+// with the fields only version 3 has intact
+func TestRelayVersion3(t *testing.T) {
+	clientConn, proxyClientConn := net.Pipe()
+	proxyServerConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	oldest, _ := proto.LookupCodec(proto.OldestProtocolVersion)
+	codec, err := proto.LookupCodec(3)
+	if err != nil {
+		t.Fatal("LookupCodec: ", err.String())
+	}
+
+	// Misread packets can come out as the same bytes, so check what the
+	// relay decoded as well as what arrives
+	decoded := make(chan proto.Packet, 16)
+	record := func(packet proto.Packet, toServer bool) proto.Packet {
+		if !toServer {
+			select {
+			case decoded <- packet:
+			default:
+			}
+		}
+		return packet
+	}
+	p := &policy{rewriters: []Rewriter{record}}
+
+	watched := newWatchedConn(proxyServerConn)
+	startRelays(&session{policy: p, codec: oldest}, proxyClientConn, watched)
+
+	// After the handshake the relay from the server is left waiting for the
+	// login reply before the login request changes the version
+	writeLater(t, clientConn, oldest, &proto.HandshakeRequestPacket{Username: "alice"})
+	readPacket(t, serverConn, oldest, true)
+	handshake := &bytes.Buffer{}
+	oldest.Write(handshake, &proto.HandshakeReplyPacket{ConnectionHash: "-"})
+	writeLater(t, serverConn, oldest, &proto.HandshakeReplyPacket{ConnectionHash: "-"})
+	readPacket(t, clientConn, oldest, false)
+	watched.waitForRead(handshake.Len())
+
+	writeLater(t, clientConn, codec, &proto.LoginRequestPacket{
+		ProtocolVersion: 3,
+		Username:        "alice",
+		MapSeed:         12345,
+		Dimension:       1,
+	})
+	request, ok := readPacket(t, serverConn, codec, true).(*proto.LoginRequestPacket)
+	if !ok || request.Username != "alice" || request.MapSeed != 12345 || request.Dimension != 1 {
+		t.Fatalf("server got %+v", request)
+	}
+
+	writeLater(t, serverConn, codec,
+		&proto.LoginReplyPacket{EntityID: 7, MapSeed: 12345, Dimension: 1},
+		&proto.TimeUpdatePacket{Time: 6000})
+	reply, ok := readPacket(t, clientConn, codec, false).(*proto.LoginReplyPacket)
+	if !ok || reply.EntityID != 7 || reply.MapSeed != 12345 || reply.Dimension != 1 {
+		t.Fatalf("client got %+v", reply)
+	}
+	update, ok := readPacket(t, clientConn, codec, false).(*proto.TimeUpdatePacket)
+	if !ok || update.Time != 6000 {
+		t.Fatalf("client got %+v after the login reply", update)
+	}
+
+	<-decoded // the handshake reply
+	reply, ok = (<-decoded).(*proto.LoginReplyPacket)
+	if !ok || reply.MapSeed != 12345 || reply.Dimension != 1 {
+		t.Fatalf("relay decoded %+v", reply)
+	}
+	update, ok = (<-decoded).(*proto.TimeUpdatePacket)
+	if !ok || update.Time != 6000 {
+		t.Fatalf("relay decoded %+v after the login reply", update)
+	}
+}
+
+// A packet that is not in packets.def and everything after it reach the
+// client unchanged, and packets from the client are still decoded
+func TestRelayUnknownPacket(t *testing.T) {
+	clientConn, proxyClientConn := net.Pipe()
+	proxyServerConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	codec, _ := proto.LookupCodec(proto.OldestProtocolVersion)
+	startRelays(&session{policy: &policy{}, codec: codec}, proxyClientConn, proxyServerConn)
+
+	// Entity (0x1e) with entity ID 42, then a time update
+	const entityPacketID = 0x1e
+	if proto.NewClientboundPacket(entityPacketID, codec.Version) != nil {
+		t.Fatalf("packet %#02x is in packets.def, pick another", entityPacketID)
+	}
+	sent := &bytes.Buffer{}
+	sent.Write([]byte{entityPacketID, 0, 0, 0, 42})
+	codec.Write(sent, &proto.TimeUpdatePacket{Time: 6000})
+	go func() {
+		_, err := serverConn.Write(sent.Bytes())
+		if err != nil {
+			t.Error("Write: ", err.String())
+		}
+	}()
+
+	received := make([]byte, sent.Len())
+	_, err := io.ReadFull(clientConn, received)
+	if err != nil {
+		t.Fatal("Read: ", err.String())
+	}
+	if !bytes.Equal(received, sent.Bytes()) {
+		t.Fatalf("client got % x instead of % x", received, sent.Bytes())
+	}
+
+	writeLater(t, clientConn, codec, &proto.ChatMessagePacket{Message: "hello"})
+	chat, ok := readPacket(t, serverConn, codec, true).(*proto.ChatMessagePacket)
+	if !ok || chat.Message != "hello" {
+		t.Fatalf("server got %+v", chat)
+	}
+}
@@ -0,0 +1,61 @@
+// Packet rewriters
+//
+// To add a rewriter, write a Rewriter function and register it in the
+// rewriters table below.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"proto"
+)
+
+// A Rewriter returns the packet to forward in place of the one received
+// toServer is true for packets sent by the client.
+type Rewriter func(packet proto.Packet, toServer bool) proto.Packet
+
+var rewriters = map[string]Rewriter{
+	"freeze-time": freezeTime,
+	"tag-chat":    tagChat,
+}
+
+// Parse a comma-separated list of rewriter names
+func lookupRewriters(list string) (selected []Rewriter, err os.Error) {
+	names := strings.Split(list, ",", -1)
+	selected = make([]Rewriter, 0, len(names))
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		rewriter, ok := rewriters[name]
+		if !ok {
+			return nil, os.NewError("unknown rewriter " + name)
+		}
+		n := len(selected)
+		selected = selected[0 : n+1]
+		selected[n] = rewriter
+	}
+	return
+}
+
+// Keep the client at midday, useful when debugging rendering
+func freezeTime(packet proto.Packet, toServer bool) proto.Packet {
+	const midday = 6000
+
+	if p, ok := packet.(*proto.TimeUpdatePacket); ok {
+		p.Time = midday
+	}
+	return packet
+}
+
+// Mark chat messages that passed through the proxy
+func tagChat(packet proto.Packet, toServer bool) proto.Packet {
+	if p, ok := packet.(*proto.ChatMessagePacket); ok && !toServer {
+		p.Message = "[proxy] " + p.Message
+	}
+	return packet
+}
@@ -0,0 +1,168 @@
+// Print the packets in a recording as a timeline
+//
+// usage: recdump [flags] <recording>
+//
+// Recorded data is decoded into packets in both directions and printed one
+// per line, as text or as JSON objects.
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"json"
+	"log"
+	"proto"
+	"record"
+)
+
+var format = flag.String("format", "text", "output format, text or json")
+var typeIDs = flag.String("types", "", "comma-separated packet IDs to print, e.g. 0x03,0x0b (default all)")
+var direction = flag.String("direction", "both", "packets to print: toServer, toClient or both")
+var from = flag.Float64("from", 0, "seconds into the recording to start printing at")
+var to = flag.Float64("to", 0, "seconds into the recording to stop printing at (default end)")
+var includeData = flag.Bool("data", false, "include compressed map chunk data in JSON output")
+
+// A line of JSON output
+type entry struct {
+	Time      float64 // seconds since the start of the recording
+	Direction string
+	ID        byte
+	Type      string
+	Packet    proto.Packet
+}
+
+func printPacket(seconds float64, toServer bool, packet proto.Packet) (err os.Error) {
+	if *format == "json" {
+		e := &entry{seconds, "toClient", packet.ID(), proto.PacketName(packet), packet}
+		if toServer {
+			e.Direction = "toServer"
+		}
+		if p, ok := packet.(*proto.MapChunkPacket); ok && !*includeData {
+			p.CompressedData = nil
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", b)
+		return err
+	}
+
+	arrow := "<-"
+	if toServer {
+		arrow = "->"
+	}
+	_, err = fmt.Printf("%10.3f %s %s\n", seconds, arrow, proto.Describe(packet))
+	return
+}
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <recording>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "json" {
+		log.Exit("--format must be text or json")
+	}
+	if *direction != "toServer" && *direction != "toClient" && *direction != "both" {
+		log.Exit("--direction must be toServer, toClient or both")
+	}
+	types, err := proto.ParseIDList(*typeIDs)
+	if err != nil {
+		log.Exit("--types: ", err.String())
+	}
+
+	file, err := os.Open(flag.Arg(0), os.O_RDONLY, 0)
+	if err != nil {
+		log.Exit(err.String())
+	}
+	defer file.Close()
+
+	reader, err := record.NewReader(file)
+	if err != nil {
+		log.Exit("reading header: ", err.String())
+	}
+
+	// Old recordings do not say which protocol version they hold, so it is
+	// taken from the client's login request
+	version := reader.ProtocolVersion
+	if version == 0 {
+		version = proto.OldestProtocolVersion
+	}
+	codec, err := proto.LookupCodec(version)
+	if err != nil {
+		log.Exit(err.String())
+	}
+
+	// Packets may be split across records in old recordings
+	streams := [2]*proto.PacketBuffer{
+		record.FromClient: proto.NewPacketBuffer(codec, true),
+		record.ToClient:   proto.NewPacketBuffer(codec, false),
+	}
+
+	var timestamp int64
+	for {
+		rec, err := reader.Next()
+		if err == os.EOF {
+			break
+		}
+		if err != nil {
+			log.Exit("reading record: ", err.String())
+		}
+		if int(rec.Direction) >= len(streams) {
+			log.Exitf("invalid direction %d", rec.Direction)
+		}
+
+		timestamp += rec.Timestamp
+		seconds := float64(timestamp) / 1e9
+		if *to > 0 && seconds > *to {
+			break
+		}
+
+		toServer := rec.Direction == record.FromClient
+		s := streams[rec.Direction]
+		s.Write(rec.Data)
+		for {
+			packet, _, err := s.Next()
+			if err != nil {
+				log.Exitf("%.3fs: %s", seconds, err.String())
+			}
+			if packet == nil {
+				break
+			}
+
+			if login, ok := packet.(*proto.LoginRequestPacket); ok && reader.ProtocolVersion == 0 {
+				codec, err = proto.LookupCodec(login.ProtocolVersion)
+				if err != nil {
+					log.Exit(err.String())
+				}
+				for _, stream := range streams {
+					stream.SetCodec(codec)
+				}
+			}
+
+			if seconds < *from || (len(types) > 0 && !types[packet.ID()]) {
+				continue
+			}
+			if (toServer && *direction == "toClient") || (!toServer && *direction == "toServer") {
+				continue
+			}
+
+			err = printPacket(seconds, toServer, packet)
+			if err != nil {
+				log.Exit(err.String())
+			}
+		}
+	}
+}
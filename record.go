@@ -1,50 +1,143 @@
-// Wrapper for net.Conn which supports recording and replaying received data
+// Wrapper for net.Conn which supports recording traffic
 
 package main
 
 import (
-	"io"
 	"os"
 	"net"
 	"log"
 	"flag"
+	"sync"
+	"bytes"
 	"time"
 	"encoding/binary"
+	"proto"
+	"record"
 )
 
-// Log record header
-type header struct {
-	Timestamp int64 // delay since last packet, in nanoseconds
-	Length    int32 // length of data bytes
-}
+// When the server started, stored in recordings to tell sessions apart
+var serverStartTime = time.Nanoseconds()
 
+// Data is recorded a packet at a time so that recordings can be edited packet
+// by packet and replayed whatever reads the replaying code makes.  Should a
+// direction fail to decode, the rest of it is recorded as it arrives.
 type recorder struct {
 	conn          net.Conn
-	log           io.WriteCloser
+	log           *os.File
+	path          string
+	lock          sync.Mutex // reads and writes are recorded concurrently
 	lastTimestamp int64
+	streams       [2]*proto.PacketBuffer
+	unaligned     [2]bool
+}
+
+func newRecorder(conn net.Conn, log *os.File, path string) (*recorder, os.Error) {
+	err := record.WriteFileHeader(log, 0, serverStartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Packets before the login request are the same in all versions
+	codec, err := proto.LookupCodec(proto.OldestProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &recorder{conn: conn, log: log, path: path, lastTimestamp: time.Nanoseconds()}
+	recorder.streams[record.FromClient] = proto.NewPacketBuffer(codec, true)
+	recorder.streams[record.ToClient] = proto.NewPacketBuffer(codec, false)
+	return recorder, nil
+}
+
+// Switch to the protocol version the client logs in with
+// This must be called with the lock held.
+func (recorder *recorder) setProtocolVersion(version int32) {
+	codec, err := proto.LookupCodec(version)
+	if err != nil {
+		return // the login will fail
+	}
+	for _, stream := range recorder.streams {
+		stream.SetCodec(codec)
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, version)
+	_, err = recorder.log.WriteAt(buf.Bytes(), record.ProtocolVersionOffset)
+	if err != nil {
+		log.Stderr("Recording protocol version: ", err.String())
+	}
+}
+
+// This must be called with the lock held.
+func (recorder *recorder) write(now int64, direction byte, data []byte) {
+	record.WriteRecord(recorder.log, now-recorder.lastTimestamp, direction, data)
+	recorder.lastTimestamp = now
+}
+
+func (recorder *recorder) add(direction byte, b []byte) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	now := time.Nanoseconds()
+	if recorder.unaligned[direction] {
+		recorder.write(now, direction, b)
+		return
+	}
+
+	stream := recorder.streams[direction]
+	stream.Write(b)
+	for {
+		packet, data, err := stream.Next()
+		if err != nil {
+			log.Stderr("Recording ", recorder.path, " without packet boundaries: ", err.String())
+			recorder.unaligned[direction] = true
+			recorder.write(now, direction, stream.Flush())
+			return
+		}
+		if packet == nil {
+			return // wait for the rest of the packet
+		}
+
+		recorder.write(now, direction, data)
+
+		if login, ok := packet.(*proto.LoginRequestPacket); ok {
+			recorder.setProtocolVersion(login.ProtocolVersion)
+		}
+	}
 }
 
 func (recorder *recorder) Read(b []byte) (n int, err os.Error) {
 	n, err = recorder.conn.Read(b)
-	if err == nil {
-		now := time.Nanoseconds()
-		binary.Write(recorder.log, binary.BigEndian, &header{
-			now - recorder.lastTimestamp,
-			int32(n),
-		})
-		binary.Write(recorder.log, binary.BigEndian, b[:n])
-
-		recorder.lastTimestamp = now
+	if n > 0 {
+		recorder.add(record.FromClient, b[:n])
 	}
 	return
 }
 
 func (recorder *recorder) Write(b []byte) (n int, err os.Error) {
-	return recorder.conn.Write(b)
+	n, err = recorder.conn.Write(b)
+	if n > 0 {
+		recorder.add(record.ToClient, b[:n])
+	}
+	return
 }
 
 func (recorder *recorder) Close() os.Error {
+	recorder.lock.Lock()
+
+	// Keep partial packets, they may be what a bug is about
+	now := time.Nanoseconds()
+	for direction, stream := range recorder.streams {
+		if stream.Len() > 0 {
+			recorder.write(now, byte(direction), stream.Flush())
+		}
+	}
 	recorder.log.Close()
+	activeRecordingsLock.Lock()
+	activeRecordings[recorder.path] = false, false
+	activeRecordingsLock.Unlock()
+
+	recorder.lock.Unlock()
 	return recorder.conn.Close()
 }
 
@@ -68,89 +161,70 @@ func (recorder *recorder) SetWriteTimeout(nsec int64) os.Error {
 	return recorder.conn.SetWriteTimeout(nsec)
 }
 
-type replayer struct {
-	conn          net.Conn
-	log           io.ReadCloser
-	lastTimestamp int64
-}
+var recordDir = flag.String("record", "", "record each connection's traffic to a file in this directory")
+var recordMaxSize = flag.Int("record-max-size", 0, "MiB of recordings to keep, 0 for no limit")
+var recordMaxAge = flag.Int("record-max-age", 0, "hours to keep recordings for, 0 for no limit")
 
-func (replayer *replayer) Read(b []byte) (n int, err os.Error) {
-	var header header
+// Paths of the recordings of open connections, which must not be pruned
+var activeRecordings = make(map[string]bool)
+var activeRecordingsLock sync.Mutex
 
-	err = binary.Read(replayer.log, binary.BigEndian, &header)
-	if err != nil {
-		return 0, err
+// Name a connection's recording, if it has one, after the client's username
+func RecordLogin(conn net.Conn, username string) {
+	recorder, ok := conn.(*recorder)
+	if !ok {
+		return
 	}
 
-	if int32(len(b)) < header.Length {
-		return 0, os.NewError("replay read length too small")
-	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	activeRecordingsLock.Lock()
+	defer activeRecordingsLock.Unlock()
 
-	// Wait until recorded time has passed
-	now := time.Nanoseconds()
-	delta := now - replayer.lastTimestamp
-	if delta < header.Timestamp {
-		time.Sleep(header.Timestamp - delta)
+	newPath, err := nameRecording(recorder.path, username)
+	if err != nil {
+		log.Stderr("RecordLogin: ", err.String())
+		return
 	}
-	replayer.lastTimestamp = now
-
-	return replayer.log.Read(b[:header.Length])
-}
-
-func (replayer *replayer) Write(b []byte) (n int, err os.Error) {
-	return replayer.conn.Write(b)
-}
-
-func (replayer *replayer) Close() os.Error {
-	replayer.log.Close()
-	return replayer.conn.Close()
-}
-
-func (replayer *replayer) LocalAddr() net.Addr {
-	return replayer.conn.LocalAddr()
+	activeRecordings[recorder.path] = false, false
+	activeRecordings[newPath] = true
+	recorder.path = newPath
 }
 
-func (replayer *replayer) RemoteAddr() net.Addr {
-	return replayer.conn.RemoteAddr()
-}
+// Start recording a new connection
+func recordConn(raw net.Conn) (wrapped net.Conn, err os.Error) {
+	activeRecordingsLock.Lock()
+	defer activeRecordingsLock.Unlock()
 
-func (replayer *replayer) SetTimeout(nsec int64) os.Error {
-	return replayer.conn.SetTimeout(nsec)
-}
+	err = pruneRecordings(*recordDir, int64(*recordMaxSize)*1024*1024, int64(*recordMaxAge)*3600*1e9, activeRecordings)
+	if err != nil {
+		log.Stderr("pruneRecordings: ", err.String())
+	}
 
-func (replayer *replayer) SetReadTimeout(nsec int64) os.Error {
-	return replayer.conn.SetReadTimeout(nsec)
-}
+	file, path, err := createRecording(*recordDir, raw.RemoteAddr().String())
+	if err != nil {
+		return
+	}
 
-func (replayer *replayer) SetWriteTimeout(nsec int64) os.Error {
-	return replayer.conn.SetWriteTimeout(nsec)
+	wrapped, err = newRecorder(raw, file, path)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return
+	}
+	activeRecordings[path] = true
+	return
 }
 
-var record = flag.String("record", "", "record received packets to file")
-var replay = flag.String("replay", "", "replay received packets from file")
-var connections = 0
-
-// Interpose a recorder or replayer onto a network connection
+// Interpose a recorder onto a network connection
 func WrapConn(raw net.Conn) (wrapped net.Conn) {
-	if *record != "" {
-		file, err := os.Open(*record, os.O_CREAT|os.O_TRUNC|os.O_WRONLY, 0644)
+	if *recordDir != "" {
+		wrapped, err := recordConn(raw)
 		if err != nil {
-			log.Exit("WrapConn: ", err.String())
+			log.Stderr("WrapConn: not recording: ", err.String())
+			return raw
 		}
-
-		return &recorder{raw, file, time.Nanoseconds()}
+		return wrapped
 	}
-
-	// The second client connection will replay the log file
-	if connections == 1 && *replay != "" {
-		file, err := os.Open(*replay, os.O_RDONLY, 0)
-		if err != nil {
-			log.Exit("WrapConn: ", err.String())
-		}
-
-		return &replayer{raw, file, time.Nanoseconds()}
-	}
-	connections++
-
 	return raw
 }
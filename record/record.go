@@ -0,0 +1,129 @@
+// Recording file format
+//
+// A recording starts with a file header followed by one record per read or
+// write on a connection.  Recordings made before the file header existed hold
+// only data received from the client and are still understood by Reader.
+
+package record
+
+import (
+	"io"
+	"os"
+	"bytes"
+	"encoding/binary"
+)
+
+// Identifies recordings with a file header.  Read as the first record's delay
+// of an old recording it would be over a century, so the formats cannot be
+// confused.
+var Magic = [8]byte{'C', 'M', 'R', 'E', 'C', 'v', '2', '\n'}
+
+type FileHeader struct {
+	Magic           [8]byte
+	ProtocolVersion int32 // zero if the client never logged in
+	StartTime       int64 // server start time, in nanoseconds since the epoch
+}
+
+// Offset of ProtocolVersion in the file header
+const ProtocolVersionOffset = 8
+
+// Direction of recorded data
+const (
+	FromClient = 0
+	ToClient   = 1
+)
+
+// Record header
+type Header struct {
+	Timestamp int64 // delay since last record, in nanoseconds
+	Direction byte
+	Length    int32 // length of data bytes
+}
+
+// Record header of recordings without a file header
+type oldHeader struct {
+	Timestamp int64
+	Length    int32
+}
+
+func WriteFileHeader(writer io.Writer, version int32, startTime int64) os.Error {
+	return binary.Write(writer, binary.BigEndian, &FileHeader{Magic, version, startTime})
+}
+
+// Write a record in a single call so that concurrent records cannot interleave
+func WriteRecord(writer io.Writer, timestamp int64, direction byte, data []byte) (err os.Error) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, &Header{timestamp, direction, int32(len(data))})
+	buf.Write(data)
+	_, err = writer.Write(buf.Bytes())
+	return
+}
+
+// A record read back from a recording
+type Record struct {
+	Timestamp int64 // delay since the previous record, in nanoseconds
+	Direction byte
+	Data      []byte
+}
+
+// Reads records from both current and old recordings
+type Reader struct {
+	reader          io.Reader
+	ProtocolVersion int32 // zero if unknown
+	StartTime       int64 // zero if unknown
+	oldFormat       bool
+	firstTimestamp  int64 // the first old record's delay, read with the header
+	readFirst       bool
+}
+
+func NewReader(reader io.Reader) (r *Reader, err os.Error) {
+	var magic [8]byte
+	_, err = io.ReadFull(reader, magic[:])
+	if err != nil {
+		return
+	}
+
+	r = &Reader{reader: reader}
+	if !bytes.Equal(magic[:], Magic[:]) {
+		// An old recording starts with the first record's delay
+		r.oldFormat = true
+		err = binary.Read(bytes.NewBuffer(magic[:]), binary.BigEndian, &r.firstTimestamp)
+		return
+	}
+
+	err = binary.Read(reader, binary.BigEndian, &r.ProtocolVersion)
+	if err != nil {
+		return
+	}
+	err = binary.Read(reader, binary.BigEndian, &r.StartTime)
+	return
+}
+
+// Read the next record, returning os.EOF at the end of the recording
+func (r *Reader) Next() (record *Record, err os.Error) {
+	var h Header
+
+	if r.oldFormat {
+		var old oldHeader
+		if !r.readFirst {
+			old.Timestamp = r.firstTimestamp
+			r.readFirst = true
+			err = binary.Read(r.reader, binary.BigEndian, &old.Length)
+		} else {
+			err = binary.Read(r.reader, binary.BigEndian, &old)
+		}
+		h = Header{old.Timestamp, FromClient, old.Length}
+	} else {
+		err = binary.Read(r.reader, binary.BigEndian, &h)
+	}
+	if err != nil {
+		return
+	}
+
+	record = &Record{h.Timestamp, h.Direction, make([]byte, h.Length)}
+	_, err = io.ReadFull(r.reader, record.Data)
+	if err == os.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
@@ -0,0 +1,121 @@
+// Directory of per-connection recordings
+
+package main
+
+import (
+	"os"
+	"log"
+	"path"
+	"sort"
+	"time"
+	"strings"
+)
+
+const recordingSuffix = ".rec"
+
+// Make a string safe to use in a file name
+func fileNameSafe(s string) string {
+	safe := func(c int) int {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-':
+			return c
+		}
+		return '_'
+	}
+	return strings.Map(safe, s)
+}
+
+// Create the recording file for a new connection
+// The file is named by time and remote address and renamed by
+// nameRecording when the client's username is known.
+func createRecording(dir string, remoteAddr string) (file *os.File, filePath string, err os.Error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	base := time.LocalTime().Format("20060102-150405") + "-" + fileNameSafe(remoteAddr)
+	filePath = path.Join(dir, base+recordingSuffix)
+	file, err = os.Open(filePath, os.O_CREAT|os.O_EXCL|os.O_WRONLY, 0644)
+	return
+}
+
+// Add the username to a recording's file name
+func nameRecording(filePath string, username string) (newPath string, err os.Error) {
+	newPath = filePath[0:len(filePath)-len(recordingSuffix)] + "-" + fileNameSafe(username) + recordingSuffix
+	err = os.Rename(filePath, newPath)
+	return
+}
+
+type recordingsByAge []*os.FileInfo
+
+func (r recordingsByAge) Len() int {
+	return len(r)
+}
+
+func (r recordingsByAge) Less(i, j int) bool {
+	return r[i].Mtime_ns < r[j].Mtime_ns
+}
+
+func (r recordingsByAge) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+// Delete the oldest recordings until those left are younger than maxAge
+// nanoseconds and no larger than maxSize bytes in total.  Zero disables a
+// limit.  Recordings whose paths are in active are still being written; they
+// count towards the size but are never deleted.
+func pruneRecordings(dir string, maxSize int64, maxAge int64, active map[string]bool) (err os.Error) {
+	if maxSize <= 0 && maxAge <= 0 {
+		return
+	}
+
+	f, err := os.Open(dir, os.O_RDONLY, 0)
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Error == os.ENOENT {
+		return nil // nothing has been recorded yet
+	}
+	if err != nil {
+		return
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	recordings := make(recordingsByAge, 0, len(infos))
+	var totalSize int64
+	for i := range infos {
+		info := &infos[i]
+		if !info.IsRegular() || !strings.HasSuffix(info.Name, recordingSuffix) {
+			continue
+		}
+
+		n := len(recordings)
+		recordings = recordings[0 : n+1]
+		recordings[n] = info
+		totalSize += info.Size
+	}
+	sort.Sort(recordings)
+
+	now := time.Nanoseconds()
+	for _, info := range recordings {
+		tooOld := maxAge > 0 && now-info.Mtime_ns > maxAge
+		tooBig := maxSize > 0 && totalSize > maxSize
+		if !tooOld && !tooBig {
+			break
+		}
+
+		filePath := path.Join(dir, info.Name)
+		if active[filePath] {
+			continue
+		}
+		err = os.Remove(filePath)
+		if err != nil {
+			log.Stderr("pruneRecordings: ", err.String())
+			continue
+		}
+		totalSize -= info.Size
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path"
+	"time"
+	"testing"
+	"io/ioutil"
+)
+
+// Write a recording of size bytes last modified age nanoseconds ago
+func writeRecording(t *testing.T, filePath string, size int, age int64) {
+	err := ioutil.WriteFile(filePath, make([]byte, size), 0644)
+	if err != nil {
+		t.Fatal(err.String())
+	}
+	mtime := time.Nanoseconds() - age
+	err = os.Chtimes(filePath, mtime, mtime)
+	if err != nil {
+		t.Fatal(err.String())
+	}
+}
+
+func exists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+// The oldest recording goes first when over the size limit, unless it is
+// still being written
+func TestPruneRecordingsKeepsActive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err.String())
+	}
+	defer os.RemoveAll(dir)
+
+	open := path.Join(dir, "open.rec")
+	oldest := path.Join(dir, "oldest.rec")
+	newest := path.Join(dir, "newest.rec")
+	writeRecording(t, open, 100, 3e9)
+	writeRecording(t, oldest, 100, 2e9)
+	writeRecording(t, newest, 100, 1e9)
+
+	err = pruneRecordings(dir, 250, 0, map[string]bool{open: true})
+	if err != nil {
+		t.Fatal(err.String())
+	}
+	if !exists(open) {
+		t.Error("deleted the recording still being written")
+	}
+	if exists(oldest) {
+		t.Error("kept the oldest closed recording")
+	}
+	if !exists(newest) {
+		t.Error("deleted the newest recording")
+	}
+}
+
+// Before the first connection the directory does not exist yet
+func TestPruneRecordingsMissingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err.String())
+	}
+	defer os.RemoveAll(dir)
+
+	err = pruneRecordings(path.Join(dir, "missing"), 1024, 3600e9, nil)
+	if err != nil {
+		t.Error(err.String())
+	}
+}
@@ -0,0 +1,253 @@
+// Virtual players that replay recorded sessions
+//
+// Each replayed session logs in through an in-process connection, so no
+// real clients are needed to simulate a multiplayer game.
+
+package main
+
+import (
+	"os"
+	"log"
+	"net"
+	"flag"
+	"sync"
+	"bytes"
+	"strings"
+	"proto"
+	"record"
+)
+
+var replay = flag.String("replay", "", "comma-separated recordings to replay as virtual players")
+var replayLoop = flag.Bool("replay-loop", false, "start recordings again when they finish")
+var replaySpeed = flag.Float64("replay-speed", 1, "speed multiplier for replayed recordings")
+
+// The address of a replayed connection is the recording it plays
+type replayAddr string
+
+func (addr replayAddr) Network() string {
+	return "replay"
+}
+
+func (addr replayAddr) String() string {
+	return string(addr)
+}
+
+// An in-process net.Conn that reads the client packets of a recording
+// Packets are decoded and encoded again, so the server reads them the same way
+// whether the recording was made a packet at a time or not.  Data sent to the
+// client is discarded.
+type replayConn struct {
+	path          string
+	log           *os.File
+	reader        *record.Reader
+	packets       *proto.PacketBuffer
+	clock         Clock
+	speed         float64
+	pending       []byte // encoded packets not yet read
+	lastTimestamp int64  // clock time of the last delivered packets
+	closeLock     sync.Mutex
+	closed        chan bool
+}
+
+func newReplayConn(path string, clock Clock, speed float64) (*replayConn, os.Error) {
+	file, err := os.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := record.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Old recordings do not say which protocol version they hold, so it is
+	// taken from the client's login request
+	version := reader.ProtocolVersion
+	if version == 0 {
+		version = proto.OldestProtocolVersion
+	}
+	codec, err := proto.LookupCodec(version)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &replayConn{
+		path:          path,
+		log:           file,
+		reader:        reader,
+		packets:       proto.NewPacketBuffer(codec, true),
+		clock:         clock,
+		speed:         speed,
+		lastTimestamp: clock.Now(),
+		closed:        make(chan bool),
+	}, nil
+}
+
+// Read records until they complete at least one packet, returning the
+// packets encoded again along with the time they took to record
+func (conn *replayConn) nextPackets() (data []byte, delay int64, err os.Error) {
+	buf := &bytes.Buffer{}
+	for buf.Len() == 0 {
+		rec, err := conn.reader.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Data sent to the client is not replayed but its delays still count
+		delay += rec.Timestamp
+		if rec.Direction != record.FromClient {
+			continue
+		}
+
+		conn.packets.Write(rec.Data)
+		for {
+			packet, _, err := conn.packets.Next()
+			if err != nil {
+				return nil, 0, err
+			}
+			if packet == nil {
+				break
+			}
+
+			if login, ok := packet.(*proto.LoginRequestPacket); ok && conn.reader.ProtocolVersion == 0 {
+				codec, err := proto.LookupCodec(login.ProtocolVersion)
+				if err == nil {
+					conn.packets.SetCodec(codec)
+				}
+			}
+
+			err = conn.packets.Codec().Write(buf, packet)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return buf.Bytes(), delay, nil
+}
+
+func (conn *replayConn) Read(b []byte) (n int, err os.Error) {
+	select {
+	case <-conn.closed:
+		return 0, os.EOF
+	default:
+	}
+
+	if len(conn.pending) == 0 {
+		var delay int64
+		conn.pending, delay, err = conn.nextPackets()
+		if err != nil {
+			return
+		}
+
+		// Wait until recorded time has passed
+		delay = int64(float64(delay) / conn.speed)
+		if !conn.clock.WaitUntil(conn.lastTimestamp+delay, conn.closed) {
+			return 0, os.EOF
+		}
+		conn.lastTimestamp = conn.clock.Now()
+	}
+
+	n = copy(b, conn.pending)
+	conn.pending = conn.pending[n:]
+	return
+}
+
+func (conn *replayConn) Write(b []byte) (n int, err os.Error) {
+	return len(b), nil
+}
+
+// Close may be called more than once, by the player's receive and transmit
+// loops.
+func (conn *replayConn) Close() os.Error {
+	conn.closeLock.Lock()
+	defer conn.closeLock.Unlock()
+
+	select {
+	case <-conn.closed:
+		return nil
+	default:
+	}
+
+	close(conn.closed)
+	return conn.log.Close()
+}
+
+func (conn *replayConn) LocalAddr() net.Addr {
+	return replayAddr(conn.path)
+}
+
+func (conn *replayConn) RemoteAddr() net.Addr {
+	return replayAddr(conn.path)
+}
+
+// Timeouts do not apply to replayed data
+func (conn *replayConn) SetTimeout(nsec int64) os.Error {
+	return nil
+}
+
+func (conn *replayConn) SetReadTimeout(nsec int64) os.Error {
+	return nil
+}
+
+func (conn *replayConn) SetWriteTimeout(nsec int64) os.Error {
+	return nil
+}
+
+// Replay a recording as a virtual player, repeatedly if looping
+// The caller must have joined the game's clock on our behalf, so that the
+// clock knows to wait for the replay to start.
+func runReplay(game *Game, path string, loop bool, speed float64) {
+	defer game.clock.Leave()
+
+	for {
+		conn, err := newReplayConn(path, game.clock, speed)
+		if err != nil {
+			log.Stderr("Replay ", path, ": ", err.String())
+			return
+		}
+
+		log.Stderr("Replaying ", path)
+		game.Login(conn)
+		<-conn.closed
+
+		if !loop {
+			return
+		}
+
+		// Do not spin on recordings that end straight away
+		game.clock.WaitUntil(game.clock.Now()+1e9, nil)
+	}
+}
+
+// Start replaying the recordings named by the --replay flag
+// Returns a channel that is closed when all replays have finished.
+func StartReplays(game *Game) (finished chan bool) {
+	finished = make(chan bool)
+	if *replay == "" {
+		close(finished)
+		return
+	}
+	if *replaySpeed <= 0 {
+		log.Exit("--replay-speed must be positive")
+	}
+
+	paths := strings.Split(*replay, ",", -1)
+	done := make(chan bool)
+	for _, path := range paths {
+		game.clock.Join()
+		go func(path string) {
+			runReplay(game, path, *replayLoop, *replaySpeed)
+			done <- true
+		}(path)
+	}
+
+	go func() {
+		for _ = range paths {
+			<-done
+		}
+		close(finished)
+	}()
+	return
+}
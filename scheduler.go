@@ -0,0 +1,111 @@
+// Tick-based scheduling of delayed and repeating game actions
+
+package main
+
+import (
+	"container/heap"
+)
+
+// A scheduled task runs in the main loop when its tick is due
+type Task struct {
+	f         func(*Game)
+	due       int64 // tick count at which the task runs next
+	period    int64 // ticks between runs, zero if the task runs once
+	seq       int64 // orders tasks that are due on the same tick
+	cancelled bool
+}
+
+// Stop a task from running again
+// Like the scheduling functions this must be called from the main loop.
+func (task *Task) Cancel() {
+	task.cancelled = true
+}
+
+// taskQueue is a min-heap of tasks ordered by due tick
+type taskQueue []*Task
+
+func (q taskQueue) Len() int {
+	return len(q)
+}
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].due == q[j].due {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due < q[j].due
+}
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *taskQueue) Push(x interface{}) {
+	old := *q
+	n := len(old)
+	if n == cap(old) {
+		grown := make(taskQueue, n, 2*n+1)
+		copy(grown, old)
+		old = grown
+	}
+	*q = old[0 : n+1]
+	(*q)[n] = x.(*Task)
+}
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	task := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return task
+}
+
+type Scheduler struct {
+	tasks   taskQueue
+	nextSeq int64
+}
+
+func (scheduler *Scheduler) add(task *Task) {
+	task.seq = scheduler.nextSeq
+	scheduler.nextSeq++
+	heap.Push(&scheduler.tasks, task)
+}
+
+// Run all tasks that are due at or before the given tick
+func (scheduler *Scheduler) Run(game *Game, tick int64) {
+	for len(scheduler.tasks) > 0 && scheduler.tasks[0].due <= tick {
+		task := heap.Pop(&scheduler.tasks).(*Task)
+		if task.cancelled {
+			continue
+		}
+
+		task.f(game)
+
+		if task.period > 0 && !task.cancelled {
+			task.due += task.period
+			scheduler.add(task)
+		}
+	}
+}
+
+// Run a function once after a number of ticks
+// This must be called from the main loop.
+func (game *Game) Schedule(delayTicks int64, f func(*Game)) *Task {
+	if delayTicks < 1 {
+		delayTicks = 1
+	}
+
+	task := &Task{f: f, due: game.tickCount + delayTicks}
+	game.scheduler.add(task)
+	return task
+}
+
+// Run a function every period ticks, starting period ticks from now
+// This must be called from the main loop.
+func (game *Game) ScheduleRepeating(period int64, f func(*Game)) *Task {
+	if period < 1 {
+		period = 1
+	}
+
+	task := &Task{f: f, due: game.tickCount + period, period: period}
+	game.scheduler.add(task)
+	return task
+}
@@ -0,0 +1,176 @@
+// Tile entities hold what there is to a block beyond its type and metadata,
+// like the contents of a chest or the text on a sign
+
+package main
+
+import (
+	"nbt"
+	"proto"
+)
+
+type TileEntity interface {
+	// World block coordinates of the block the tile entity belongs to
+	Position() (x int32, y int, z int32)
+
+	// Convert the tile entity to NBT, both for saving it and for sending it
+	// to clients
+	SaveNBT() *nbt.Compound
+}
+
+// The state shared by all kinds of tile entity
+type tileEntity struct {
+	x    int32
+	y    int
+	z    int32
+	data *nbt.Compound // as loaded, so that tags we do not model are kept
+}
+
+func (tileEntity *tileEntity) Position() (x int32, y int, z int32) {
+	return tileEntity.x, tileEntity.y, tileEntity.z
+}
+
+// Update the tags common to all tile entities
+func (tileEntity *tileEntity) saveNBT(id string) *nbt.Compound {
+	if tileEntity.data == nil {
+		tileEntity.data = nbt.NewCompound()
+	}
+	data := tileEntity.data
+	data.Set("id", &nbt.String{id})
+	data.Set("x", &nbt.Int{tileEntity.x})
+	data.Set("y", &nbt.Int{int32(tileEntity.y)})
+	data.Set("z", &nbt.Int{tileEntity.z})
+	return data
+}
+
+// An item stored in a slot of a container
+type ContainerSlot struct {
+	slot byte
+	item proto.ItemSlot
+}
+
+func loadContainerSlots(data nbt.Tag) []ContainerSlot {
+	compounds := lookupCompounds(data, "Items")
+	slots := make([]ContainerSlot, len(compounds))
+	for i, compound := range compounds {
+		slots[i] = ContainerSlot{
+			byte(lookupByte(compound, "Slot")),
+			proto.ItemSlot{
+				lookupShort(compound, "id"),
+				byte(lookupByte(compound, "Count")),
+				lookupShort(compound, "Damage"),
+			},
+		}
+	}
+	return slots
+}
+
+func saveContainerSlots(slots []ContainerSlot) *nbt.List {
+	compounds := make([]*nbt.Compound, len(slots))
+	for i, slot := range slots {
+		compound := nbt.NewCompound()
+		compound.Set("Slot", &nbt.Byte{int8(slot.slot)})
+		compound.Set("id", &nbt.Short{slot.item.ID})
+		compound.Set("Count", &nbt.Byte{int8(slot.item.Count)})
+		compound.Set("Damage", &nbt.Short{slot.item.Damage})
+		compounds[i] = compound
+	}
+	return newCompoundList(compounds)
+}
+
+type Chest struct {
+	tileEntity
+	items []ContainerSlot
+}
+
+func (chest *Chest) SaveNBT() *nbt.Compound {
+	data := chest.saveNBT("Chest")
+	data.Set("Items", saveContainerSlots(chest.items))
+	return data
+}
+
+type Sign struct {
+	tileEntity
+	text [4]string
+}
+
+var signTextTags = [4]string{"Text1", "Text2", "Text3", "Text4"}
+
+func (sign *Sign) SaveNBT() *nbt.Compound {
+	data := sign.saveNBT("Sign")
+	for i, tag := range signTextTags {
+		data.Set(tag, &nbt.String{sign.text[i]})
+	}
+	return data
+}
+
+type Furnace struct {
+	tileEntity
+	burnTime int16 // ticks left until the fuel is used up
+	cookTime int16 // ticks the current item has been cooking
+	items    []ContainerSlot
+}
+
+func (furnace *Furnace) SaveNBT() *nbt.Compound {
+	data := furnace.saveNBT("Furnace")
+	data.Set("BurnTime", &nbt.Short{furnace.burnTime})
+	data.Set("CookTime", &nbt.Short{furnace.cookTime})
+	data.Set("Items", saveContainerSlots(furnace.items))
+	return data
+}
+
+type MobSpawner struct {
+	tileEntity
+	mobName string // the entity ID of the mob that is spawned, like "Pig"
+	delay   int16  // ticks until the next spawn
+}
+
+func (spawner *MobSpawner) SaveNBT() *nbt.Compound {
+	data := spawner.saveNBT("MobSpawner")
+	data.Set("EntityId", &nbt.String{spawner.mobName})
+	data.Set("Delay", &nbt.Short{spawner.delay})
+	return data
+}
+
+// Tile entities of kinds we do not know are kept as they are
+type unknownTileEntity struct {
+	tileEntity
+}
+
+func (unknown *unknownTileEntity) SaveNBT() *nbt.Compound {
+	return unknown.data
+}
+
+// Create a tile entity from its NBT representation
+func loadTileEntity(data *nbt.Compound) TileEntity {
+	base := tileEntity{
+		x:    lookupInt(data, "x"),
+		y:    int(lookupInt(data, "y")),
+		z:    lookupInt(data, "z"),
+		data: data,
+	}
+
+	switch lookupString(data, "id") {
+	case "Chest":
+		return &Chest{base, loadContainerSlots(data)}
+	case "Sign":
+		sign := &Sign{tileEntity: base}
+		for i, tag := range signTextTags {
+			sign.text[i] = lookupString(data, tag)
+		}
+		return sign
+	case "Furnace":
+		return &Furnace{
+			tileEntity: base,
+			burnTime:   lookupShort(data, "BurnTime"),
+			cookTime:   lookupShort(data, "CookTime"),
+			items:      loadContainerSlots(data),
+		}
+	case "MobSpawner":
+		return &MobSpawner{
+			tileEntity: base,
+			mobName:    lookupString(data, "EntityId"),
+			delay:      lookupShort(data, "Delay"),
+		}
+	}
+	return &unknownTileEntity{base}
+}
@@ -0,0 +1,217 @@
+// Keeping players up to date with the entities around them
+
+package main
+
+import (
+	"bytes"
+)
+
+const (
+	// Interval between absolute positions sent for each entity, in ticks.
+	// These correct any drift between where clients and the server think an
+	// entity is.
+	entityTeleportInterval = 20 * TicksPerSecond
+
+	// Relative moves hold a signed byte per axis
+	maxRelativeMove = 127
+	minRelativeMove = -128
+
+	// Smaller changes in velocity are not sent, unless the entity stops.
+	// Clients carry on moving entities at the last velocity sent, and the
+	// relative moves correct them.
+	minVelocityChange = 0.02 * EntityVelocityUnitsPerBlock
+)
+
+// What the viewers of an entity have last been told about it
+type trackedEntity struct {
+	object          EntityObject
+	x, y, z         int32 // in pixels
+	rotation, pitch byte
+	vx, vy, vz      int16 // in 1/8000 blocks per tick
+	lastTeleport    int64 // tick count when the last absolute position was sent
+	viewers         map[EntityID]*Player
+}
+
+// EntityTracker sends each player spawns, moves, velocities and removals of
+// the entities in the chunks within its radius.  Moves are sent relative to the
+// last position a viewer was told about where possible, which takes far less
+// bandwidth than an absolute position on every change.  Like the rest of the
+// game state it must only be used from the main loop.
+type EntityTracker struct {
+	entities map[EntityID]*trackedEntity
+}
+
+// Start tracking an entity
+// Players in range see it from the next update on.
+func (tracker *EntityTracker) Add(object EntityObject, tickCount int64) {
+	// EntityTracker starts initialized to zero
+	if tracker.entities == nil {
+		tracker.entities = make(map[EntityID]*trackedEntity)
+	}
+
+	tracked := &trackedEntity{
+		object:       object,
+		lastTeleport: tickCount,
+		viewers:      make(map[EntityID]*Player),
+	}
+	tracked.setSent()
+	tracker.entities[object.GetEntity().EntityID] = tracked
+}
+
+// Remember the entity's current position, look and velocity as sent
+func (tracked *trackedEntity) setSent() {
+	entity := tracked.object.GetEntity()
+	tracked.x, tracked.y, tracked.z = packPosition(&entity.position)
+	tracked.rotation = packAngle(entity.orientation.rotation)
+	tracked.pitch = packAngle(entity.orientation.pitch)
+	tracked.vx, tracked.vy, tracked.vz = packEntityVelocity(&entity.velocity)
+}
+
+// Stop tracking an entity and make it disappear for its viewers
+func (tracker *EntityTracker) Remove(object EntityObject) {
+	entityID := object.GetEntity().EntityID
+	tracked, ok := tracker.entities[entityID]
+	if !ok {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	WriteDestroyEntity(buf, entityID)
+	for _, viewer := range tracked.viewers {
+		viewer.TransmitPacket(buf.Bytes())
+	}
+	tracker.entities[entityID] = nil, false
+
+	// A departing player does not need to be told about anything anymore
+	for _, other := range tracker.entities {
+		other.viewers[entityID] = nil, false
+	}
+}
+
+// Make an entity's viewers spawn it again
+// This shows changes that no packet can update, like the size of an item
+// stack.  The spawn also brings the viewers up to date with the entity's
+// movement so far.
+func (tracker *EntityTracker) Respawn(object EntityObject) {
+	tracked, ok := tracker.entities[object.GetEntity().EntityID]
+	if !ok {
+		return
+	}
+	tracked.setSent()
+
+	buf := &bytes.Buffer{}
+	WriteDestroyEntity(buf, object.GetEntity().EntityID)
+	tracked.writeSpawn(buf)
+	for _, viewer := range tracked.viewers {
+		viewer.TransmitPacket(buf.Bytes())
+	}
+}
+
+// Send the changes since the last update to each entity's viewers
+// Entities are updated in order of ID so that every run of a simulation sends
+// the same packets in the same order.
+func (tracker *EntityTracker) Update(game *Game) {
+	for _, object := range game.entityManager.Entities() {
+		tracked, ok := tracker.entities[object.GetEntity().EntityID]
+		if !ok {
+			continue
+		}
+		tracked.sendMovement(game.tickCount)
+		tracked.updateViewers(game.chunkManager)
+	}
+}
+
+func fitsRelativeMove(d int32) bool {
+	return d >= minRelativeMove && d <= maxRelativeMove
+}
+
+// Whether the viewers should be told about a new velocity
+func (tracked *trackedEntity) velocityChanged(vx, vy, vz int16) bool {
+	if vx == 0 && vy == 0 && vz == 0 {
+		return tracked.vx != 0 || tracked.vy != 0 || tracked.vz != 0
+	}
+
+	changed := func(v, last int16) bool {
+		d := int32(v) - int32(last)
+		return d > minVelocityChange || d < -minVelocityChange
+	}
+	return changed(vx, tracked.vx) || changed(vy, tracked.vy) || changed(vz, tracked.vz)
+}
+
+// Tell the viewers how the entity moved since they last heard of it
+func (tracked *trackedEntity) sendMovement(tickCount int64) {
+	entity := tracked.object.GetEntity()
+	x, y, z := packPosition(&entity.position)
+	rotation := packAngle(entity.orientation.rotation)
+	pitch := packAngle(entity.orientation.pitch)
+	vx, vy, vz := packEntityVelocity(&entity.velocity)
+
+	dx, dy, dz := x-tracked.x, y-tracked.y, z-tracked.z
+	moved := dx != 0 || dy != 0 || dz != 0
+	looked := rotation != tracked.rotation || pitch != tracked.pitch
+
+	buf := &bytes.Buffer{}
+	switch {
+	case tickCount-tracked.lastTeleport >= entityTeleportInterval,
+		!fitsRelativeMove(dx) || !fitsRelativeMove(dy) || !fitsRelativeMove(dz):
+		WriteEntityTeleport(buf, entity.EntityID, x, y, z, rotation, pitch)
+		tracked.lastTeleport = tickCount
+	case moved && looked:
+		WriteEntityLookAndRelativeMove(buf, entity.EntityID, int8(dx), int8(dy), int8(dz), rotation, pitch)
+	case moved:
+		WriteEntityRelativeMove(buf, entity.EntityID, int8(dx), int8(dy), int8(dz))
+	case looked:
+		WriteEntityLook(buf, entity.EntityID, rotation, pitch)
+	}
+
+	if tracked.velocityChanged(vx, vy, vz) {
+		WriteEntityVelocity(buf, entity.EntityID, vx, vy, vz)
+		tracked.vx, tracked.vy, tracked.vz = vx, vy, vz
+	}
+	if buf.Len() == 0 {
+		return
+	}
+
+	tracked.x, tracked.y, tracked.z = x, y, z
+	tracked.rotation, tracked.pitch = rotation, pitch
+	for _, viewer := range tracked.viewers {
+		viewer.TransmitPacket(buf.Bytes())
+	}
+}
+
+// Spawn packets carry no velocity, or only a coarse one, so the last velocity
+// sent follows them
+func (tracked *trackedEntity) writeSpawn(buf *bytes.Buffer) {
+	tracked.object.WriteSpawn(buf)
+	if tracked.vx != 0 || tracked.vy != 0 || tracked.vz != 0 {
+		WriteEntityVelocity(buf, tracked.object.GetEntity().EntityID, tracked.vx, tracked.vy, tracked.vz)
+	}
+}
+
+// Spawn the entity for players whose radius it entered and remove it for
+// players whose radius it left
+func (tracked *trackedEntity) updateViewers(mgr *ChunkManager) {
+	entity := tracked.object.GetEntity()
+	inRange := mgr.Get(entity.chunkX, entity.chunkZ).players
+
+	for id, viewer := range tracked.viewers {
+		if _, ok := inRange[id]; !ok {
+			buf := &bytes.Buffer{}
+			WriteDestroyEntity(buf, entity.EntityID)
+			viewer.TransmitPacket(buf.Bytes())
+			tracked.viewers[id] = nil, false
+		}
+	}
+
+	for id, viewer := range inRange {
+		_, viewing := tracked.viewers[id]
+		if viewing || id == entity.EntityID {
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		tracked.writeSpawn(buf)
+		viewer.TransmitPacket(buf.Bytes())
+		tracked.viewers[id] = viewer
+	}
+}
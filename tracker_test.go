@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Viewers hear of large changes in an entity's velocity and of it stopping,
+// but not of small changes
+func TestEntityVelocity(t *testing.T) {
+	item := NewItemEntity(BlockDirt, 1, &XYZ{8.5, 64, 8.5}, &XYZ{})
+	item.EntityID = 2
+	tracker := &EntityTracker{}
+	tracker.Add(item, 0)
+	tracked := tracker.entities[item.EntityID]
+	viewer := newTestPlayer(1, 8.5, 8.5)
+	tracked.viewers[viewer.EntityID] = viewer
+
+	expect := func(tickCount int64, vx, vy, vz int16) {
+		tracked.sendMovement(tickCount)
+		want := &bytes.Buffer{}
+		WriteEntityVelocity(want, item.EntityID, vx, vy, vz)
+		if !bytes.Equal(viewer.txPending.Bytes(), want.Bytes()) {
+			t.Errorf("tick %d: sent %v, expected %v", tickCount, viewer.txPending.Bytes(), want.Bytes())
+		}
+		viewer.txPending.Reset()
+	}
+
+	item.velocity.y = -0.01
+	tracked.sendMovement(1)
+	if viewer.txPending.Len() != 0 {
+		t.Errorf("sent %v for a small change in velocity", viewer.txPending.Bytes())
+	}
+
+	item.velocity.y = -0.5
+	expect(2, 0, -4000, 0)
+
+	item.velocity.x = 10
+	expect(3, maxEntityVelocity, -4000, 0)
+
+	item.velocity = XYZ{}
+	expect(4, 0, 0, 0)
+}
+
+// A respawn already shows the viewers where the entity is, so the next update
+// does not move it again
+func TestRespawnUpdatesTrackedState(t *testing.T) {
+	item := NewItemEntity(BlockDirt, 1, &XYZ{8.5, 64, 8.5}, &XYZ{})
+	item.EntityID = 2
+	tracker := &EntityTracker{}
+	tracker.Add(item, 0)
+	viewer := newTestPlayer(1, 8.5, 8.5)
+	tracker.entities[item.EntityID].viewers[viewer.EntityID] = viewer
+
+	item.position.x += 1
+	item.velocity.y = -0.5
+	tracker.Respawn(item)
+	want := &bytes.Buffer{}
+	WriteDestroyEntity(want, item.EntityID)
+	item.WriteSpawn(want)
+	WriteEntityVelocity(want, item.EntityID, 0, -4000, 0)
+	if !bytes.Equal(viewer.txPending.Bytes(), want.Bytes()) {
+		t.Errorf("respawn sent %v, expected %v", viewer.txPending.Bytes(), want.Bytes())
+	}
+	viewer.txPending.Reset()
+
+	tracker.entities[item.EntityID].sendMovement(1)
+	if viewer.txPending.Len() != 0 {
+		t.Errorf("sent %v after the respawn", viewer.txPending.Bytes())
+	}
+}